@@ -0,0 +1,222 @@
+package wgconf
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Usage is an amount of data transferred with a peer.
+type Usage struct {
+	ReceiveBytes  int64 `json:"receive_bytes"`
+	TransmitBytes int64 `json:"transmit_bytes"`
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		ReceiveBytes:  u.ReceiveBytes + other.ReceiveBytes,
+		TransmitBytes: u.TransmitBytes + other.TransmitBytes,
+	}
+}
+
+// UsageBucket is the usage accumulated during a period that begins at
+// Start.
+type UsageBucket struct {
+	Start time.Time `json:"start"`
+	Usage
+}
+
+// Accountant tracks per-peer bandwidth usage across a series of device
+// observations. It is safe for concurrent use.
+//
+// The transfer counters reported by a device are reset when the device is
+// recreated or a peer is removed and added again. The accountant detects
+// counters that have decreased and treats their current values as the usage
+// since the reset, so that accumulated usage never decreases. Usage that
+// occurs between a reset and the observation before it is lost.
+//
+// Usage is aggregated into hourly and daily buckets in UTC. The first
+// observation of a peer establishes a baseline and is not counted.
+type Accountant struct {
+	// HourlyRetention and DailyRetention limit how long buckets are kept.
+	// If zero, buckets are kept indefinitely.
+	HourlyRetention time.Duration
+	DailyRetention  time.Duration
+
+	mu    sync.Mutex
+	peers map[accountKey]*peerAccount
+}
+
+type accountKey struct {
+	Device    string
+	PublicKey Key
+}
+
+type peerAccount struct {
+	Device    string        `json:"device"`
+	PublicKey string        `json:"public_key"`
+	Counters  Usage         `json:"counters"`
+	Total     Usage         `json:"total"`
+	Hourly    []UsageBucket `json:"hourly,omitempty"`
+	Daily     []UsageBucket `json:"daily,omitempty"`
+}
+
+// accountantFile is the persisted form of an accountant.
+type accountantFile struct {
+	Peers []*peerAccount `json:"peers"`
+}
+
+// LoadAccountant returns an accountant with state loaded from the file at
+// path. If the file does not exist an empty accountant is returned.
+func LoadAccountant(path string) (*Accountant, error) {
+	a := &Accountant{peers: make(map[accountKey]*peerAccount)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file accountantFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, account := range file.Peers {
+		key, err := wgtypes.ParseKey(account.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		a.peers[accountKey{Device: account.Device, PublicKey: key}] = account
+	}
+
+	return a, nil
+}
+
+// Save writes the state of the accountant to the file at path. The file is
+// replaced atomically.
+func (a *Accountant) Save(path string) error {
+	a.mu.Lock()
+	file := accountantFile{Peers: make([]*peerAccount, 0, len(a.peers))}
+	for _, account := range a.peers {
+		file.Peers = append(file.Peers, account)
+	}
+	sort.Slice(file.Peers, func(i, j int) bool {
+		if file.Peers[i].Device != file.Peers[j].Device {
+			return file.Peers[i].Device < file.Peers[j].Device
+		}
+		return file.Peers[i].PublicKey < file.Peers[j].PublicKey
+	})
+	data, err := json.MarshalIndent(file, "", "\t")
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = WriteFile(path, data, WriteOptions{})
+	return err
+}
+
+// Observe accounts for the transfer counters in an observation.
+func (a *Accountant) Observe(obs Observation) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.peers == nil {
+		a.peers = make(map[accountKey]*peerAccount)
+	}
+
+	hour := obs.Time.UTC().Truncate(time.Hour)
+	day := time.Date(hour.Year(), hour.Month(), hour.Day(), 0, 0, 0, 0, time.UTC)
+
+	for _, status := range obs.Peers {
+		counters := Usage{ReceiveBytes: status.ReceiveBytes, TransmitBytes: status.TransmitBytes}
+
+		key := accountKey{Device: obs.Device, PublicKey: status.PublicKey}
+		account, found := a.peers[key]
+		if !found {
+			a.peers[key] = &peerAccount{
+				Device:    obs.Device,
+				PublicKey: status.PublicKey.String(),
+				Counters:  counters,
+			}
+			continue
+		}
+
+		delta := Usage{
+			ReceiveBytes:  counterDelta(account.Counters.ReceiveBytes, counters.ReceiveBytes),
+			TransmitBytes: counterDelta(account.Counters.TransmitBytes, counters.TransmitBytes),
+		}
+		account.Counters = counters
+		account.Total = account.Total.Add(delta)
+		account.Hourly = addToBucket(account.Hourly, hour, delta)
+		account.Daily = addToBucket(account.Daily, day, delta)
+		if a.HourlyRetention > 0 {
+			account.Hourly = pruneBuckets(account.Hourly, obs.Time.Add(-a.HourlyRetention))
+		}
+		if a.DailyRetention > 0 {
+			account.Daily = pruneBuckets(account.Daily, obs.Time.Add(-a.DailyRetention))
+		}
+	}
+}
+
+// Total returns the total usage accumulated for a peer.
+func (a *Accountant) Total(device string, key Key) Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if account, found := a.peers[accountKey{Device: device, PublicKey: key}]; found {
+		return account.Total
+	}
+	return Usage{}
+}
+
+// Hourly returns the hourly usage buckets for a peer in chronological order.
+func (a *Accountant) Hourly(device string, key Key) []UsageBucket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if account, found := a.peers[accountKey{Device: device, PublicKey: key}]; found {
+		return append([]UsageBucket(nil), account.Hourly...)
+	}
+	return nil
+}
+
+// Daily returns the daily usage buckets for a peer in chronological order.
+func (a *Accountant) Daily(device string, key Key) []UsageBucket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if account, found := a.peers[accountKey{Device: device, PublicKey: key}]; found {
+		return append([]UsageBucket(nil), account.Daily...)
+	}
+	return nil
+}
+
+// counterDelta returns the amount a counter has increased by. A counter
+// that has decreased is assumed to have been reset to zero.
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+func addToBucket(buckets []UsageBucket, start time.Time, usage Usage) []UsageBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start.Equal(start) {
+		buckets[n-1].Usage = buckets[n-1].Usage.Add(usage)
+		return buckets
+	}
+	return append(buckets, UsageBucket{Start: start, Usage: usage})
+}
+
+func pruneBuckets(buckets []UsageBucket, cutoff time.Time) []UsageBucket {
+	i := 0
+	for i < len(buckets) && buckets[i].Start.Before(cutoff) {
+		i++
+	}
+	return buckets[i:]
+}
@@ -0,0 +1,64 @@
+package wgconf_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestAccountant(t *testing.T) {
+	t0 := time.Date(2022, 6, 1, 23, 30, 0, 0, time.UTC)
+	key := mustParseKey(public1)
+
+	observe := func(a *wgconf.Accountant, at time.Time, rx, tx int64) {
+		a.Observe(wgconf.Observation{
+			Device: "wg0",
+			Time:   at,
+			Peers: wgconf.PeerStatusList{
+				{Peer: wgconf.Peer{PublicKey: key}, ReceiveBytes: rx, TransmitBytes: tx},
+			},
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "usage.json")
+	a, err := wgconf.LoadAccountant(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observe(a, t0, 1000, 100)                     // Baseline
+	observe(a, t0.Add(10*time.Minute), 1500, 150) // +500/+50
+	observe(a, t0.Add(40*time.Minute), 200, 20)   // Reset: +200/+20
+
+	// Reload the state from disk to make sure it survives a restart
+	if err := a.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = wgconf.LoadAccountant(path); err != nil {
+		t.Fatal(err)
+	}
+
+	observe(a, t0.Add(50*time.Minute), 300, 30) // +100/+10
+
+	if got, want := a.Total("wg0", key), (wgconf.Usage{ReceiveBytes: 800, TransmitBytes: 80}); got != want {
+		t.Errorf("unexpected total usage: want %+v, got %+v", want, got)
+	}
+
+	hourly := a.Hourly("wg0", key)
+	if len(hourly) != 2 {
+		t.Fatalf("unexpected number of hourly buckets: %d", len(hourly))
+	}
+	if got, want := hourly[0].Usage, (wgconf.Usage{ReceiveBytes: 500, TransmitBytes: 50}); got != want || !hourly[0].Start.Equal(t0.Truncate(time.Hour)) {
+		t.Errorf("unexpected first hourly bucket: %+v", hourly[0])
+	}
+	if got, want := hourly[1].Usage, (wgconf.Usage{ReceiveBytes: 300, TransmitBytes: 30}); got != want {
+		t.Errorf("unexpected second hourly bucket: %+v", hourly[1])
+	}
+
+	daily := a.Daily("wg0", key)
+	if len(daily) != 2 || daily[1].Start.Day() != 2 {
+		t.Fatalf("unexpected daily buckets: %+v", daily)
+	}
+}
@@ -0,0 +1,167 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ChangeSet is a serializable set of peer changes for a WireGuard device.
+// It can be generated on one machine, reviewed, and applied later on
+// another.
+//
+// Each change carries a precondition on the state of the device. Added
+// peers must be absent, removed peers must be present, and updated peers
+// must be present with their expected allowed IP addresses. ApplyChangeSet
+// refuses to apply a change set whose preconditions no longer hold.
+type ChangeSet struct {
+	Device string       `json:"device"`
+	Add    PeerList     `json:"add,omitempty"`
+	Update []PeerUpdate `json:"update,omitempty"`
+	Remove PeerList     `json:"remove,omitempty"`
+}
+
+// PeerUpdate is an update to a peer within a change set.
+type PeerUpdate struct {
+	// Peer is the desired configuration of the peer.
+	Peer Peer `json:"peer"`
+
+	// Expected holds the allowed IP addresses that the peer is expected to
+	// have on the device before the update is applied.
+	Expected AllowedIPs `json:"expected_allowed_ips"`
+}
+
+// NewChangeSet returns the set of changes needed to move a device from its
+// current peers to the desired peers, as determined by CompareLists.
+//
+// The current peers are annotated with the desired peers before they are
+// compared, so peers collected from a device are not reported as updated
+// merely because the device does not record their names, descriptions or
+// labels.
+func NewChangeSet(device string, current, desired PeerList) ChangeSet {
+	current, _ = Annotate(current, desired)
+	added, updated, removed, _ := CompareLists(current, desired)
+
+	// Prepare a map so we can look up current peers by their public key
+	lookup := make(map[Key]Peer, len(current))
+	for i := len(current) - 1; i >= 0; i-- {
+		lookup[current[i].PublicKey] = current[i]
+	}
+
+	cs := ChangeSet{
+		Device: device,
+		Add:    added,
+		Remove: removed,
+	}
+	for _, peer := range updated {
+		cs.Update = append(cs.Update, PeerUpdate{
+			Peer:     peer,
+			Expected: lookup[peer.PublicKey].AllowedIPs,
+		})
+	}
+	return cs
+}
+
+// Empty returns true if the change set contains no changes.
+func (cs ChangeSet) Empty() bool {
+	return len(cs.Add) == 0 && len(cs.Update) == 0 && len(cs.Remove) == 0
+}
+
+// Check verifies the preconditions of the change set against the current
+// peers of the device. It returns a *PreconditionError if any of them do
+// not hold.
+func (cs ChangeSet) Check(current PeerList) error {
+	lookup := make(map[Key]Peer, len(current))
+	for _, peer := range current {
+		lookup[peer.PublicKey] = peer
+	}
+
+	var violations []string
+	for _, peer := range cs.Add {
+		if _, found := lookup[peer.PublicKey]; found {
+			violations = append(violations, fmt.Sprintf("peer %s to be added is already present", peerTitle(peer)))
+		}
+	}
+	for _, update := range cs.Update {
+		existing, found := lookup[update.Peer.PublicKey]
+		switch {
+		case !found:
+			violations = append(violations, fmt.Sprintf("peer %s to be updated is not present", peerTitle(update.Peer)))
+		case !sameIPNetSet(existing.AllowedIPs, update.Expected):
+			violations = append(violations, fmt.Sprintf("peer %s to be updated has allowed IPs %q instead of %q", peerTitle(update.Peer), existing.AllowedIPs, update.Expected))
+		}
+	}
+	for _, peer := range cs.Remove {
+		if _, found := lookup[peer.PublicKey]; !found {
+			violations = append(violations, fmt.Sprintf("peer %s to be removed is not present", peerTitle(peer)))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PreconditionError{Device: cs.Device, Violations: violations}
+	}
+	return nil
+}
+
+// config returns the device configuration that applies the change set.
+func (cs ChangeSet) config() wgtypes.Config {
+	updated := make(PeerList, 0, len(cs.Update))
+	for _, update := range cs.Update {
+		updated = append(updated, update.Peer)
+	}
+	return wgtypes.Config{
+		Peers: peerConfigs(cs.Add, updated, cs.Remove),
+	}
+}
+
+// ApplyChangeSet applies a change set to its device. The current peers of
+// the device are collected first, and the change set is only applied if
+// all of its preconditions hold.
+func ApplyChangeSet(client Client, cs ChangeSet) error {
+	return ApplyChangeSetContext(context.Background(), client, cs)
+}
+
+// ApplyChangeSetContext applies a change set to its device in the same way
+// as ApplyChangeSet. It returns early if ctx is cancelled or its deadline is
+// exceeded.
+func ApplyChangeSetContext(ctx context.Context, client Client, cs ChangeSet) error {
+	current, err := CollectPeersContext(ctx, client, cs.Device)
+	if err != nil {
+		return err
+	}
+	if err := cs.Check(current); err != nil {
+		return err
+	}
+	if cs.Empty() {
+		return nil
+	}
+	return configureContext(ctx, client, cs.Device, cs.config())
+}
+
+// PreconditionError is returned when a change set cannot be applied because
+// the device no longer matches its preconditions.
+type PreconditionError struct {
+	Device     string
+	Violations []string
+}
+
+// Error returns a string representation of the error.
+func (e *PreconditionError) Error() string {
+	return fmt.Sprintf("wgconf: change set for %s does not match the device: %s", e.Device, strings.Join(e.Violations, "; "))
+}
+
+// sameIPNetSet returns true if a and b contain the same IP networks,
+// regardless of order.
+func sameIPNetSet(a, b AllowedIPs) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append(AllowedIPs(nil), a...)
+	bs := append(AllowedIPs(nil), b...)
+	sort.Slice(as, func(i, j int) bool { return compareIPNet(as[i], as[j]) < 0 })
+	sort.Slice(bs, func(i, j int) bool { return compareIPNet(bs[i], bs[j]) < 0 })
+	return sameIPNets(as, bs)
+}
@@ -0,0 +1,116 @@
+package wgconf_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestChangeSet(t *testing.T) {
+	newClient := func() *fakeClient {
+		return newFakeClient(wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+				{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+			},
+		})
+	}
+
+	current, err := wgconf.CollectPeers(newClient(), "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32"), mustParseIPNet("10.0.1.0/24")}},
+		{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32")}},
+	}
+
+	// Serialize the change set and read it back, as if it had been approved
+	data, err := json.Marshal(wgconf.NewChangeSet("wg0", current, desired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cs wgconf.ChangeSet
+	if err := json.Unmarshal(data, &cs); err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Add) != 1 || len(cs.Update) != 1 || len(cs.Remove) != 1 {
+		t.Fatalf("unexpected change set: %s", data)
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		client := newClient()
+		if err := wgconf.ApplyChangeSet(client, cs); err != nil {
+			t.Fatal(err)
+		}
+		result, err := wgconf.CollectPeers(client, "wg0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added, updated, removed, _ := wgconf.CompareLists(result, desired); len(added)+len(updated)+len(removed) != 0 {
+			t.Fatalf("device does not match the desired peers:\n%s", result.NetDev())
+		}
+
+		// Applying the same change set again must fail
+		var perr *wgconf.PreconditionError
+		if err := wgconf.ApplyChangeSet(client, cs); !errors.As(err, &perr) || len(perr.Violations) != 3 {
+			t.Fatalf("unexpected error when reapplying change set: %v", err)
+		}
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		client := newClient()
+		client.setPeer("wg0", wgtypes.Peer{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.9/32")}})
+		calls := len(client.calls)
+
+		var perr *wgconf.PreconditionError
+		if err := wgconf.ApplyChangeSet(client, cs); !errors.As(err, &perr) || len(perr.Violations) != 1 {
+			t.Fatalf("unexpected error when applying change set to a modified device: %v", err)
+		}
+		if len(client.calls) != calls {
+			t.Fatalf("device was configured despite failed preconditions")
+		}
+	})
+}
+
+func TestChangeSetNamedPeers(t *testing.T) {
+	client := newFakeClient(wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+		},
+	})
+	current, err := wgconf.CollectPeers(client, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := wgconf.PeerList{
+		{Name: "P1", Description: "first", Labels: wgconf.Labels{"owner": "alice"}, PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "P2", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.1.0/24")}},
+	}
+
+	cs := wgconf.NewChangeSet("wg0", current, desired)
+	if len(cs.Add) != 0 || len(cs.Remove) != 0 || len(cs.Update) != 1 {
+		t.Fatalf("unexpected change set: %+v", cs)
+	}
+	if got := cs.Update[0].Peer.Name; got != "P2" {
+		t.Fatalf("unexpected peer updated: %s", got)
+	}
+
+	// Once the device matches, there is nothing left to do
+	if err := wgconf.ApplyChangeSet(client, cs); err != nil {
+		t.Fatal(err)
+	}
+	if current, err = wgconf.CollectPeers(client, "wg0"); err != nil {
+		t.Fatal(err)
+	}
+	if cs := wgconf.NewChangeSet("wg0", current, desired); !cs.Empty() {
+		t.Fatalf("expected an empty change set for named peers, got %+v", cs)
+	}
+}
@@ -0,0 +1,16 @@
+package wgconf
+
+import (
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Client is the subset of WireGuard device operations that are used by this
+// package. It is implemented by *wgctrl.Client, and can be implemented by
+// other types for testing purposes.
+type Client interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+var _ Client = (*wgctrl.Client)(nil)
@@ -0,0 +1,159 @@
+package wgconf_test
+
+import (
+	"net"
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// fakeClient is an in-memory WireGuard client that applies configuration
+// changes the way the kernel does.
+type fakeClient struct {
+	mu        sync.Mutex
+	devices   map[string]*wgtypes.Device
+	configErr func(name string, cfg wgtypes.Config) error
+	calls     []wgtypes.Config
+}
+
+func newFakeClient(devices ...wgtypes.Device) *fakeClient {
+	c := &fakeClient{devices: make(map[string]*wgtypes.Device)}
+	for i := range devices {
+		dev := devices[i]
+		dev.Peers = append([]wgtypes.Peer(nil), dev.Peers...)
+		for i := range dev.Peers {
+			dev.Peers[i].AllowedIPs = append([]net.IPNet(nil), dev.Peers[i].AllowedIPs...)
+		}
+		c.devices[dev.Name] = &dev
+	}
+	return c
+}
+
+func (c *fakeClient) Device(name string) (*wgtypes.Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dev, ok := c.devices[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	out := *dev
+	out.Peers = append([]wgtypes.Peer(nil), dev.Peers...)
+	for i := range out.Peers {
+		out.Peers[i].AllowedIPs = append([]net.IPNet(nil), out.Peers[i].AllowedIPs...)
+	}
+	return &out, nil
+}
+
+func (c *fakeClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dev, ok := c.devices[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if c.configErr != nil {
+		if err := c.configErr(name, cfg); err != nil {
+			return err
+		}
+	}
+	c.calls = append(c.calls, cfg)
+
+	if cfg.PrivateKey != nil {
+		dev.PrivateKey = *cfg.PrivateKey
+		dev.PublicKey = cfg.PrivateKey.PublicKey()
+	}
+	if cfg.ListenPort != nil {
+		dev.ListenPort = *cfg.ListenPort
+	}
+	if cfg.FirewallMark != nil {
+		dev.FirewallMark = *cfg.FirewallMark
+	}
+	if cfg.ReplacePeers {
+		dev.Peers = nil
+	}
+
+	for _, pc := range cfg.Peers {
+		index := -1
+		for i := range dev.Peers {
+			if dev.Peers[i].PublicKey == pc.PublicKey {
+				index = i
+				break
+			}
+		}
+		switch {
+		case pc.Remove:
+			if index >= 0 {
+				dev.Peers = append(dev.Peers[:index], dev.Peers[index+1:]...)
+			}
+			continue
+		case index < 0 && pc.UpdateOnly:
+			continue
+		case index < 0:
+			dev.Peers = append(dev.Peers, wgtypes.Peer{PublicKey: pc.PublicKey})
+			index = len(dev.Peers) - 1
+		}
+		peer := &dev.Peers[index]
+		if pc.Endpoint != nil {
+			peer.Endpoint = pc.Endpoint
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			peer.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+		}
+		if pc.PresharedKey != nil {
+			peer.PresharedKey = *pc.PresharedKey
+		}
+		if pc.ReplaceAllowedIPs {
+			peer.AllowedIPs = nil
+		}
+		for _, ipnet := range pc.AllowedIPs {
+			// Host bits are cleared, as the kernel does
+			ipnet = net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+
+			// Allowed IPs are moved from any other peer that holds them
+			for i := range dev.Peers {
+				dev.Peers[i].AllowedIPs = removeIPNet(dev.Peers[i].AllowedIPs, ipnet)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, ipnet)
+		}
+	}
+
+	return nil
+}
+
+func removeIPNet(list []net.IPNet, ipnet net.IPNet) []net.IPNet {
+	out := list[:0]
+	for _, item := range list {
+		if item.String() != ipnet.String() {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// setPeer replaces or adds runtime state for a peer on a fake device.
+func (c *fakeClient) setPeer(name string, peer wgtypes.Peer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dev := c.devices[name]
+	for i := range dev.Peers {
+		if dev.Peers[i].PublicKey == peer.PublicKey {
+			dev.Peers[i] = peer
+			return
+		}
+	}
+	dev.Peers = append(dev.Peers, peer)
+}
+
+// removePeer removes a peer from a fake device.
+func (c *fakeClient) removePeer(name string, key wgtypes.Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dev := c.devices[name]
+	for i := range dev.Peers {
+		if dev.Peers[i].PublicKey == key {
+			dev.Peers = append(dev.Peers[:i], dev.Peers[i+1:]...)
+			return
+		}
+	}
+}
@@ -1,13 +1,42 @@
 package wgconf
 
-import "golang.zx2c4.com/wireguard/wgctrl"
+import (
+	"context"
+	"fmt"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
 
 // CollectPeers returns the current set of WireGuard peers for a device.
-func CollectPeers(client *wgctrl.Client, device string) (PeerList, error) {
-	dev, err := client.Device(device)
+func CollectPeers(client Client, device string) (PeerList, error) {
+	return CollectPeersContext(context.Background(), client, device)
+}
+
+// CollectPeersContext returns the current set of WireGuard peers for a
+// device. It returns early if ctx is cancelled or its deadline is exceeded.
+func CollectPeersContext(ctx context.Context, client Client, device string) (PeerList, error) {
+	dev, err := deviceContext(ctx, client, device)
 	if err != nil {
 		return nil, err
 	}
+	return devicePeers(dev), nil
+}
+
+// collectAnnotated collects the current state of a device and returns it
+// along with its peers, annotated with the names, descriptions and labels
+// of the matching peers in inventory. Devices don't store names, so without
+// annotation every named peer would be treated as an update.
+func collectAnnotated(ctx context.Context, client Client, device string, inventory PeerList) (*wgtypes.Device, PeerList, error) {
+	dev, err := deviceContext(ctx, client, device)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to collect WireGuard device %s: %w", device, err)
+	}
+	current, _ := Annotate(devicePeers(dev), inventory)
+	return dev, current, nil
+}
+
+// devicePeers returns the peers of a device.
+func devicePeers(dev *wgtypes.Device) PeerList {
 	var list PeerList
 	for _, peer := range dev.Peers {
 		list = append(list, Peer{
@@ -15,5 +44,41 @@ func CollectPeers(client *wgctrl.Client, device string) (PeerList, error) {
 			AllowedIPs: peer.AllowedIPs,
 		})
 	}
+	return list
+}
+
+// CollectPeerStatus returns the current configuration and runtime state of
+// the WireGuard peers for a device.
+func CollectPeerStatus(client Client, device string) (PeerStatusList, error) {
+	return CollectPeerStatusContext(context.Background(), client, device)
+}
+
+// CollectPeerStatusContext returns the current configuration and runtime
+// state of the WireGuard peers for a device. It returns early if ctx is
+// cancelled or its deadline is exceeded.
+func CollectPeerStatusContext(ctx context.Context, client Client, device string) (PeerStatusList, error) {
+	dev, err := deviceContext(ctx, client, device)
+	if err != nil {
+		return nil, err
+	}
+	var list PeerStatusList
+	for _, peer := range dev.Peers {
+		list = append(list, newPeerStatus(peer))
+	}
 	return list, nil
 }
+
+func newPeerStatus(peer wgtypes.Peer) PeerStatus {
+	return PeerStatus{
+		Peer: Peer{
+			PublicKey:  peer.PublicKey,
+			AllowedIPs: peer.AllowedIPs,
+		},
+		Endpoint:                    peer.Endpoint,
+		LastHandshake:               peer.LastHandshakeTime,
+		ReceiveBytes:                peer.ReceiveBytes,
+		TransmitBytes:               peer.TransmitBytes,
+		PersistentKeepaliveInterval: peer.PersistentKeepaliveInterval,
+		ProtocolVersion:             peer.ProtocolVersion,
+	}
+}
@@ -2,6 +2,7 @@ package wgconf
 
 import (
 	"bytes"
+	"net"
 	"sort"
 	"strings"
 )
@@ -18,7 +19,7 @@ func Compare(a, b Peer) int {
 	// Compare IP addresses in AllowedIP lists
 	alen, blen := len(a.AllowedIPs), len(b.AllowedIPs)
 	for i := 0; i < alen && i < blen; i++ {
-		if cmp := bytes.Compare(a.AllowedIPs[i].IP, b.AllowedIPs[i].IP); cmp != 0 {
+		if cmp := compareIPNet(a.AllowedIPs[i], b.AllowedIPs[i]); cmp != 0 {
 			return cmp
 		}
 	}
@@ -44,6 +45,72 @@ func Compare(a, b Peer) int {
 		return cmp
 	}
 
+	// Compare labels
+	if cmp := compareLabels(a.Labels, b.Labels); cmp != 0 {
+		return cmp
+	}
+
+	// Compare disabled state
+	switch {
+	case !a.Disabled && b.Disabled:
+		return -1
+	case a.Disabled && !b.Disabled:
+		return 1
+	}
+
+	return 0
+}
+
+// compareIPNet compares IP networks by their network address and then by
+// their mask. Host bits are ignored, because devices report the masked
+// network. IPv4 addresses are compared in their 16-byte form so that 4-byte
+// and 16-byte representations of the same address are equivalent.
+func compareIPNet(a, b net.IPNet) int {
+	if cmp := bytes.Compare(networkIP(a).To16(), networkIP(b).To16()); cmp != 0 {
+		return cmp
+	}
+	aones, abits := a.Mask.Size()
+	bones, bbits := b.Mask.Size()
+	if abits == net.IPv4len*8 {
+		aones += 96
+	}
+	if bbits == net.IPv4len*8 {
+		bones += 96
+	}
+	switch {
+	case aones < bones:
+		return -1
+	case aones > bones:
+		return 1
+	}
+	return 0
+}
+
+// networkIP returns the address of the network with its host bits cleared.
+// If the mask is not valid for the address, the address is returned as is.
+func networkIP(ipnet net.IPNet) net.IP {
+	if ip := ipnet.IP.Mask(ipnet.Mask); ip != nil {
+		return ip
+	}
+	return ipnet.IP
+}
+
+func compareLabels(a, b Labels) int {
+	akeys, bkeys := a.Keys(), b.Keys()
+	for i := 0; i < len(akeys) && i < len(bkeys); i++ {
+		if cmp := strings.Compare(akeys[i], bkeys[i]); cmp != 0 {
+			return cmp
+		}
+		if cmp := strings.Compare(a[akeys[i]], b[bkeys[i]]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(akeys) < len(bkeys):
+		return -1
+	case len(akeys) > len(bkeys):
+		return 1
+	}
 	return 0
 }
 
@@ -0,0 +1,279 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is the desired configuration of a set of WireGuard devices.
+type Config struct {
+	// Devices maps device names to their configuration.
+	Devices map[string]DeviceConfig `json:"devices"`
+
+	// AllowSharedKeys permits the same peer public key to appear on more
+	// than one device. By default Validate rejects it.
+	AllowSharedKeys bool `json:"allow_shared_keys,omitempty"`
+}
+
+// DeviceConfig is the desired configuration of a single WireGuard device.
+type DeviceConfig struct {
+	Interface Interface `json:"interface"`
+	Peers     PeerList  `json:"peers"`
+}
+
+// DeviceNames returns the names of the configured devices in sorted order.
+func (c Config) DeviceNames() []string {
+	names := make([]string, 0, len(c.Devices))
+	for name := range c.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the configuration for problems. Unless AllowSharedKeys is
+// set, it returns a *SharedKeyError if a peer public key appears on more
+// than one device.
+func (c Config) Validate() error {
+	for name := range c.Devices {
+		if name == "" {
+			return fmt.Errorf("wgconf: configuration contains a device without a name")
+		}
+	}
+
+	if c.AllowSharedKeys {
+		return nil
+	}
+
+	devices := make(map[Key][]string)
+	for _, name := range c.DeviceNames() {
+		seen := make(map[Key]bool)
+		for _, peer := range c.Devices[name].Peers {
+			if peer.PublicKey == zeroKey || seen[peer.PublicKey] {
+				continue
+			}
+			seen[peer.PublicKey] = true
+			devices[peer.PublicKey] = append(devices[peer.PublicKey], name)
+		}
+	}
+
+	var shared []SharedKey
+	for key, names := range devices {
+		if len(names) > 1 {
+			shared = append(shared, SharedKey{PublicKey: key, Devices: names})
+		}
+	}
+	if len(shared) == 0 {
+		return nil
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		return shared[i].PublicKey.String() < shared[j].PublicKey.String()
+	})
+	return &SharedKeyError{Shared: shared}
+}
+
+// SharedKey identifies a peer public key that appears on more than one
+// device.
+type SharedKey struct {
+	PublicKey Key
+	Devices   []string
+}
+
+// SharedKeyError is returned by Config.Validate when one or more peer
+// public keys appear on more than one device.
+type SharedKeyError struct {
+	Shared []SharedKey
+}
+
+// Error returns a string representation of the error.
+func (e *SharedKeyError) Error() string {
+	var keys []string
+	for _, shared := range e.Shared {
+		keys = append(keys, fmt.Sprintf("%s on %s", shared.PublicKey, strings.Join(shared.Devices, ", ")))
+	}
+	return fmt.Sprintf("wgconf: peers appear on more than one device: %s", strings.Join(keys, "; "))
+}
+
+// NetDev returns systemd netdev configuration for the given device. It
+// includes the [NetDev] and [WireGuard] sections followed by the device's
+// peers. Interface settings that are nil are omitted.
+//
+// It returns an empty string if the device is not configured.
+func (c Config) NetDev(device string) string {
+	dc, ok := c.Devices[device]
+	if !ok {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[NetDev]\n")
+	sb.WriteString("Name=" + device + "\n")
+	sb.WriteString("Kind=wireguard\n")
+	sb.WriteString("\n[WireGuard]\n")
+	if dc.Interface.PrivateKey != nil {
+		sb.WriteString("PrivateKey=" + dc.Interface.PrivateKey.String() + "\n")
+	}
+	if dc.Interface.ListenPort != nil {
+		sb.WriteString("ListenPort=" + strconv.Itoa(*dc.Interface.ListenPort) + "\n")
+	}
+	if dc.Interface.FirewallMark != nil {
+		sb.WriteString("FirewallMark=" + strconv.Itoa(*dc.Interface.FirewallMark) + "\n")
+	}
+	if peers := dc.Peers.NetDev(); peers != "" {
+		sb.WriteString("\n")
+		sb.WriteString(peers)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// NetDevs returns systemd netdev configuration for every device, keyed by
+// device name.
+func (c Config) NetDevs() map[string]string {
+	files := make(map[string]string, len(c.Devices))
+	for name := range c.Devices {
+		files[name] = c.NetDev(name)
+	}
+	return files
+}
+
+// WriteNetDevs writes the netdev configuration of each device to
+// dir/<device>.netdev with WriteFile. It returns the names of the files that
+// were changed.
+//
+// The files may contain private keys. When they are created with the
+// default mode of 0640 they should belong to the systemd-network group.
+func (c Config) WriteNetDevs(dir string, opts WriteOptions) (written []string, err error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	for _, name := range c.DeviceNames() {
+		file := name + ".netdev"
+		changed, err := WriteFile(filepath.Join(dir, file), []byte(c.NetDev(name)), opts)
+		if err != nil {
+			return written, err
+		}
+		if changed {
+			written = append(written, file)
+		}
+	}
+	return written, nil
+}
+
+// CollectConfig returns the current configuration of the given devices.
+func CollectConfig(client Client, devices ...string) (Config, error) {
+	return CollectConfigContext(context.Background(), client, devices...)
+}
+
+// CollectConfigContext returns the current configuration of the given
+// devices. It returns early if ctx is cancelled or its deadline is exceeded.
+func CollectConfigContext(ctx context.Context, client Client, devices ...string) (Config, error) {
+	cfg := Config{Devices: make(map[string]DeviceConfig, len(devices))}
+	for _, device := range devices {
+		dev, err := deviceContext(ctx, client, device)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to collect WireGuard device %s: %w", device, err)
+		}
+		cfg.Devices[device] = DeviceConfig{
+			Interface: newInterface(dev),
+			Peers:     devicePeers(dev),
+		}
+	}
+	return cfg, nil
+}
+
+// ReconcileConfig updates the interface settings and peers of every
+// configured device to match the configuration. Peers present on a device
+// but absent from its configuration are removed. Interface settings that
+// are nil are left unchanged.
+//
+// The configuration is validated first. Each device is reconciled with
+// Reconcile and the given options, and a failure on one device does not
+// prevent the others from being reconciled. If any device fails a
+// *ConfigError is returned. The results of all devices that were attempted
+// are returned, keyed by device name.
+func ReconcileConfig(client Client, cfg Config, opts ReconcileOptions) (map[string]ReconcileResult, error) {
+	return ReconcileConfigContext(context.Background(), client, cfg, opts)
+}
+
+// ReconcileConfigContext updates every configured device in the same way as
+// ReconcileConfig. Devices that have not been reconciled when ctx is
+// cancelled or its deadline is exceeded fail with the context's error.
+func ReconcileConfigContext(ctx context.Context, client Client, cfg Config, opts ReconcileOptions) (map[string]ReconcileResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]ReconcileResult, len(cfg.Devices))
+	failed := make(map[string]error)
+	for _, device := range cfg.DeviceNames() {
+		result, err := reconcileDevice(ctx, client, device, cfg.Devices[device], opts)
+		results[device] = result
+		if err != nil {
+			failed[device] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, &ConfigError{Failed: failed}
+	}
+	return results, nil
+}
+
+// reconcileDevice collects the current state of a device and reconciles
+// it with the desired configuration.
+//
+// Peers are reconciled before interface settings, so that a snapshot
+// requested by opts captures the interface settings before they change.
+func reconcileDevice(ctx context.Context, client Client, device string, desired DeviceConfig, opts ReconcileOptions) (ReconcileResult, error) {
+	dev, current, err := collectAnnotated(ctx, client, device, desired.Peers)
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+
+	result, err := ReconcileContext(ctx, client, device, current, desired.Peers, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// Apply any interface settings that differ
+	changes := CompareInterface(newInterface(dev), desired.Interface)
+	if changes.Empty() {
+		return result, nil
+	}
+	if err := configureContext(ctx, client, device, changes.config()); err != nil {
+		return result, fmt.Errorf("failed to configure interface of WireGuard device %s: %w", device, err)
+	}
+	result.Interface = changes
+	return result, nil
+}
+
+// ConfigError is returned when one or more devices could not be
+// reconciled with a configuration.
+type ConfigError struct {
+	// Failed maps device names to the error encountered for each.
+	Failed map[string]error
+}
+
+// Devices returns the names of the failed devices in sorted order.
+func (e *ConfigError) Devices() []string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Error returns a string representation of the error.
+func (e *ConfigError) Error() string {
+	var failures []string
+	for _, name := range e.Devices() {
+		failures = append(failures, fmt.Sprintf("%s: %v", name, e.Failed[name]))
+	}
+	return fmt.Sprintf("wgconf: failed to reconcile %d WireGuard device(s): %s", len(failures), strings.Join(failures, "; "))
+}
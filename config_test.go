@@ -0,0 +1,204 @@
+package wgconf_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cfg := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg0": {Peers: wgconf.PeerList{
+			{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+		}},
+		"wg1": {Peers: wgconf.PeerList{
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.2/32")}},
+			{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.3/32")}},
+		}},
+	}}
+
+	var shared *wgconf.SharedKeyError
+	if err := cfg.Validate(); !errors.As(err, &shared) {
+		t.Fatalf("expected a shared key error, got %v", err)
+	}
+	if len(shared.Shared) != 1 || shared.Shared[0].PublicKey != mustParseKey(public2) {
+		t.Fatalf("unexpected shared keys: %v", shared)
+	}
+	if devices := shared.Shared[0].Devices; len(devices) != 2 || devices[0] != "wg0" || devices[1] != "wg1" {
+		t.Errorf("unexpected devices for shared key: %v", devices)
+	}
+
+	cfg.AllowSharedKeys = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error when shared keys are allowed: %v", err)
+	}
+}
+
+func TestConfigNetDev(t *testing.T) {
+	privateKey := mustParseKey(public7)
+	listenPort := 51820
+	cfg := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg0": {
+			Interface: wgconf.Interface{PrivateKey: &privateKey, ListenPort: &listenPort},
+			Peers: wgconf.PeerList{
+				{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+			},
+		},
+		"wg1": {},
+	}}
+
+	const want0 = `[NetDev]
+Name=wg0
+Kind=wireguard
+
+[WireGuard]
+PrivateKey=gPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+ListenPort=51820
+
+# P1
+[WireGuardPeer]
+PublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.1/32
+`
+	const want1 = `[NetDev]
+Name=wg1
+Kind=wireguard
+
+[WireGuard]
+`
+
+	files := cfg.NetDevs()
+	if diff := multilineDiff(files["wg0"], want0); diff != "" {
+		t.Errorf("unexpected netdev for wg0 (-want +got):\n%s", diff)
+	}
+	if diff := multilineDiff(files["wg1"], want1); diff != "" {
+		t.Errorf("unexpected netdev for wg1 (-want +got):\n%s", diff)
+	}
+
+	// The peers must survive a round trip through ParseNetDev
+	parsed, err := wgconf.ParseNetDev(strings.NewReader(files["wg0"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(parsed), "P1"); diff != "" {
+		t.Errorf("unexpected parsed peers (-want +got):\n%s", diff)
+	}
+
+	dir := t.TempDir()
+	written, err := cfg.WriteNetDevs(dir, wgconf.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("unexpected files written: %v", written)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "wg0.netdev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want0 {
+		t.Errorf("unexpected contents of wg0.netdev:\n%s", data)
+	}
+}
+
+func TestReconcileConfig(t *testing.T) {
+	listenPort := 51820
+	client := newFakeClient(
+		wgtypes.Device{
+			Name:       "wg0",
+			ListenPort: listenPort,
+			Peers: []wgtypes.Peer{
+				{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+				{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+			},
+		},
+		wgtypes.Device{Name: "wg1"},
+	)
+
+	desired := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg0": {Peers: wgconf.PeerList{
+			{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		}},
+		"wg1": {Peers: wgconf.PeerList{
+			{Name: "P3", PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.3/32")}},
+		}},
+		"wg2": {Peers: wgconf.PeerList{
+			{Name: "P4", PublicKey: mustParseKey(public4), AllowedIPs: []net.IPNet{mustParseIPNet("10.2.0.4/32")}},
+		}},
+	}}
+
+	results, err := wgconf.ReconcileConfig(client, desired, wgconf.ReconcileOptions{})
+	var cfgErr *wgconf.ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("expected a config error for the missing device, got %v", err)
+	}
+	if devices := cfgErr.Devices(); len(devices) != 1 || devices[0] != "wg2" {
+		t.Fatalf("unexpected failed devices: %v", devices)
+	}
+	if !errors.Is(cfgErr.Failed["wg2"], os.ErrNotExist) {
+		t.Errorf("unexpected error for wg2: %v", cfgErr.Failed["wg2"])
+	}
+	if r := results["wg0"]; len(r.Removed) != 1 || len(r.Added)+len(r.Updated) != 0 {
+		t.Errorf("unexpected result for wg0: %+v", r)
+	}
+	if r := results["wg1"]; len(r.Added) != 1 || len(r.Removed)+len(r.Updated) != 0 {
+		t.Errorf("unexpected result for wg1: %+v", r)
+	}
+
+	collected, err := wgconf.CollectConfig(client, "wg0", "wg1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers := collected.Devices["wg0"].Peers; len(peers) != 1 || peers[0].PublicKey != mustParseKey(public1) {
+		t.Errorf("unexpected peers on wg0: %v", peers)
+	}
+	if port := collected.Devices["wg0"].Interface.ListenPort; port == nil || *port != listenPort {
+		t.Errorf("unexpected listen port on wg0: %v", port)
+	}
+	if n := len(collected.Devices["wg1"].Peers); n != 1 {
+		t.Errorf("unexpected number of peers on wg1: %d", n)
+	}
+}
+
+func TestReconcileConfigDisabledPeers(t *testing.T) {
+	client := newFakeClient(wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		},
+	})
+
+	desired := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg0": {Peers: wgconf.PeerList{
+			{Name: "Disabled", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}, Disabled: true},
+			{Name: "Keyless", AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+			{Name: "Unrouted", PublicKey: mustParseKey(public3)},
+			{Name: "Enabled", PublicKey: mustParseKey(public4), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.4/32")}},
+		}},
+	}}
+
+	results, err := wgconf.ReconcileConfig(client, desired, wgconf.ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results["wg0"]; len(r.Added) != 1 || len(r.Removed) != 1 || len(r.Updated) != 0 {
+		t.Fatalf("unexpected result for wg0: %+v", r)
+	}
+
+	// A second run has nothing left to do
+	calls := len(client.calls)
+	results, err = wgconf.ReconcileConfig(client, desired, wgconf.ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results["wg0"]; len(r.Added)+len(r.Updated)+len(r.Removed) != 0 || len(client.calls) != calls {
+		t.Fatalf("second run was not idempotent: %+v (%d calls)", r, len(client.calls)-calls)
+	}
+}
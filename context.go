@@ -0,0 +1,77 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// The Client interface does not accept a context, so device operations are
+// run in their own goroutine and abandoned when the context is done. An
+// abandoned operation continues in the background until the client returns.
+
+// deviceContext retrieves a device with client, returning early if ctx is
+// done before the client responds.
+func deviceContext(ctx context.Context, client Client, name string) (*wgtypes.Device, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(name, err)
+	}
+
+	type response struct {
+		dev *wgtypes.Device
+		err error
+	}
+	ch := make(chan response, 1)
+	go func() {
+		dev, err := client.Device(name)
+		ch <- response{dev: dev, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, contextError(name, ctx.Err())
+	case r := <-ch:
+		return r.dev, r.err
+	}
+}
+
+// configureContext configures a device with client, returning early if ctx
+// is done before the client responds. When it returns early the change may
+// still be applied.
+func configureContext(ctx context.Context, client Client, name string, cfg wgtypes.Config) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(name, err)
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- client.ConfigureDevice(name, cfg)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return contextError(name, ctx.Err())
+	case err := <-ch:
+		return err
+	}
+}
+
+// contextError wraps a context error for an operation on a device.
+func contextError(name string, err error) error {
+	return fmt.Errorf("wgconf: operation on WireGuard device %s abandoned: %w", name, err)
+}
+
+// sleep waits for the given duration or until ctx is done, whichever comes
+// first. It returns the context's error if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
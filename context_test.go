@@ -0,0 +1,113 @@
+package wgconf_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// blockingClient is a client whose calls never return until release is
+// closed.
+type blockingClient struct {
+	release chan struct{}
+}
+
+func (c blockingClient) Device(name string) (*wgtypes.Device, error) {
+	<-c.release
+	return &wgtypes.Device{Name: name}, nil
+}
+
+func (c blockingClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	<-c.release
+	return nil
+}
+
+func TestContextDeadline(t *testing.T) {
+	client := blockingClient{release: make(chan struct{})}
+	defer close(client.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := wgconf.CollectPeersContext(ctx, client, "wg0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CollectPeersContext: expected deadline exceeded, got %v", err)
+	}
+	if _, err := wgconf.TakeSnapshotContext(ctx, client, "wg0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TakeSnapshotContext: expected deadline exceeded, got %v", err)
+	}
+	if err := wgconf.RollbackContext(ctx, client, wgconf.Snapshot{Device: "wg0"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RollbackContext: expected deadline exceeded, got %v", err)
+	}
+}
+
+// cancellingClient cancels a context after each configuration call.
+type cancellingClient struct {
+	*fakeClient
+	cancel context.CancelFunc
+}
+
+func (c cancellingClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	defer c.cancel()
+	return c.fakeClient.ConfigureDevice(name, cfg)
+}
+
+func TestReconcileContextCancelled(t *testing.T) {
+	newPeers := wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+		{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32")}},
+	}
+
+	t.Run("BetweenBatches", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Cancel the context once the first batch has been issued
+		client := cancellingClient{fakeClient: newFakeClient(wgtypes.Device{Name: "wg0"}), cancel: cancel}
+		result, err := wgconf.ReconcileContext(ctx, client, "wg0", nil, newPeers, wgconf.ReconcileOptions{BatchSize: 1})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected cancellation, got %v", err)
+		}
+		if len(result.Batches) != 1 || len(client.calls) != 1 {
+			t.Fatalf("expected a single batch before cancellation: %d results, %d calls", len(result.Batches), len(client.calls))
+		}
+	})
+
+	t.Run("AfterFailure", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The first batch fails and the context is cancelled
+		client := cancellingClient{fakeClient: newFakeClient(wgtypes.Device{Name: "wg0"}), cancel: cancel}
+		client.configErr = func(name string, cfg wgtypes.Config) error {
+			return errors.New("batch failed")
+		}
+		opts := wgconf.ReconcileOptions{BatchSize: 1, ContinueOnError: true}
+		_, err := wgconf.ReconcileContext(ctx, client, "wg0", nil, newPeers, opts)
+		var reconcileErr *wgconf.ReconcileError
+		if !errors.As(err, &reconcileErr) || len(reconcileErr.Failed) != 1 {
+			t.Fatalf("expected a reconcile error for the failed batch, got %v", err)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected cancellation, got %v", err)
+		}
+	})
+
+	t.Run("BetweenRetries", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// The first change is dropped, so verification waits to retry
+		lossy := &lossyClient{fakeClient: newFakeClient(wgtypes.Device{Name: "wg0"})}
+		opts := wgconf.ReconcileOptions{Verify: true, VerifyRetries: 1, VerifyDelay: time.Hour}
+		_, err := wgconf.ReconcileContext(ctx, lossy, "wg0", nil, newPeers, opts)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default settings for controllers.
+const (
+	DefaultControllerInterval = time.Minute
+	DefaultMinBackoff         = time.Second
+	DefaultMaxBackoff         = 5 * time.Minute
+)
+
+// Controller continuously reconciles the peers of a WireGuard device with
+// a desired set of peers.
+//
+// The desired peers are read from the source each time the controller
+// converges. The device is converged periodically, and immediately whenever
+// a value is received on the reload channel. Failed attempts are retried
+// with exponential backoff.
+type Controller struct {
+	// Client is used to collect and configure the device.
+	Client Client
+
+	// Device is the name of the WireGuard device to manage.
+	Device string
+
+	// Source provides the desired set of peers. Peers that are disabled or
+	// that lack a public key or allowed IP addresses are ignored.
+	Source PeerSource
+
+	// Interval is the amount of time between successful attempts. If zero,
+	// DefaultControllerInterval is used.
+	Interval time.Duration
+
+	// MinBackoff and MaxBackoff bound the amount of time between failed
+	// attempts. If zero, DefaultMinBackoff and DefaultMaxBackoff are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Reload, if non-nil, triggers an immediate attempt whenever a value is
+	// received. It is typically registered for SIGHUP with signal.Notify.
+	Reload <-chan os.Signal
+
+	// Report, if non-nil, is called with the status of the controller after
+	// each attempt.
+	Report func(ControllerStatus)
+
+	mu     sync.Mutex
+	status ControllerStatus
+}
+
+// ControllerStatus reports the state of a controller.
+type ControllerStatus struct {
+	// LastAttempt is the time at which the most recent attempt started.
+	LastAttempt time.Time
+
+	// LastSuccess is the time at which the most recent successful attempt
+	// started.
+	LastSuccess time.Time
+
+	// LastError is the error returned by the most recent attempt, or nil
+	// if it succeeded.
+	LastError error
+
+	// Failures is the number of consecutive failed attempts.
+	Failures int
+
+	// Added, Updated and Removed are the number of peers changed by the
+	// most recent successful attempt.
+	Added, Updated, Removed int
+}
+
+// Status returns the current status of the controller.
+func (c *Controller) Status() ControllerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Run converges the device until ctx is cancelled. It always returns a
+// non-nil error, which is ctx.Err() when ctx is cancelled.
+func (c *Controller) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.Reload:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		c.ConvergeContext(ctx)
+		timer.Reset(c.delay())
+	}
+}
+
+// Converge makes a single attempt to reconcile the device with the desired
+// set of peers and records its outcome in the controller status.
+func (c *Controller) Converge() error {
+	return c.ConvergeContext(context.Background())
+}
+
+// ConvergeContext makes a single attempt to reconcile the device in the same
+// way as Converge. The attempt is abandoned if ctx is cancelled or its
+// deadline is exceeded.
+func (c *Controller) ConvergeContext(ctx context.Context) error {
+	started := time.Now()
+	added, updated, removed, err := c.converge(ctx)
+
+	c.mu.Lock()
+	c.status.LastAttempt = started
+	c.status.LastError = err
+	if err != nil {
+		c.status.Failures++
+	} else {
+		c.status.LastSuccess = started
+		c.status.Failures = 0
+		c.status.Added, c.status.Updated, c.status.Removed = added, updated, removed
+	}
+	status := c.status
+	c.mu.Unlock()
+
+	if c.Report != nil {
+		c.Report(status)
+	}
+
+	return err
+}
+
+func (c *Controller) converge(ctx context.Context) (added, updated, removed int, err error) {
+	desired, err := c.Source.Peers()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to read desired peers: %w", err)
+	}
+
+	_, current, err := collectAnnotated(ctx, c.Client, c.Device, desired)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	result, err := ReconcileContext(ctx, c.Client, c.Device, current, desired, ReconcileOptions{})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to reconcile peers for WireGuard device %s: %w", c.Device, err)
+	}
+
+	return len(result.Added), len(result.Updated), len(result.Removed), nil
+}
+
+// delay returns the amount of time to wait before the next attempt.
+func (c *Controller) delay() time.Duration {
+	c.mu.Lock()
+	failures := c.status.Failures
+	c.mu.Unlock()
+
+	if failures == 0 {
+		if c.Interval > 0 {
+			return c.Interval
+		}
+		return DefaultControllerInterval
+	}
+
+	min, max := c.MinBackoff, c.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	backoff := min
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,152 @@
+package wgconf_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestControllerConverge(t *testing.T) {
+	desired := wgconf.PeerList{
+		{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "P2", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+	}
+	path := filepath.Join(t.TempDir(), "wg0.netdev")
+	if err := os.WriteFile(path, []byte(desired.NetDev()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newFakeClient(wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: mustParseKey(public3)}},
+	})
+	c := &wgconf.Controller{Client: client, Device: "wg0", Source: wgconf.NetDevFile(path)}
+
+	if err := c.Converge(); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Status(); status.Added != 2 || status.Removed != 1 || status.Failures != 0 {
+		t.Fatalf("unexpected status after first attempt: %+v", status)
+	}
+
+	current, err := wgconf.CollectPeers(client, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ = wgconf.Annotate(current, desired)
+	if added, updated, removed, _ := wgconf.CompareLists(current, desired); len(added)+len(updated)+len(removed) != 0 {
+		t.Fatalf("device did not converge")
+	}
+
+	// A second attempt should not change anything
+	calls := len(client.calls)
+	if err := c.Converge(); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Status(); status.Added+status.Updated+status.Removed != 0 || len(client.calls) != calls {
+		t.Fatalf("unexpected changes after second attempt: %+v", status)
+	}
+
+	// Failures should be counted
+	os.Remove(path)
+	if err := c.Converge(); err == nil {
+		t.Fatal("expected an error when the source is missing")
+	}
+	if status := c.Status(); status.Failures != 1 || status.LastError == nil {
+		t.Fatalf("unexpected status after failed attempt: %+v", status)
+	}
+}
+
+func TestControllerIgnoresDisabledPeers(t *testing.T) {
+	const netdev = `# P1
+[WireGuardPeer]
+PublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.1/32
+
+# P2
+#[WireGuardPeer]
+#PublicKey=bPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+#AllowedIPs=10.0.0.2/32
+
+# Keyless
+#[WireGuardPeer]
+#PublicKey=
+#AllowedIPs=10.0.0.3/32
+
+# Addressless
+#[WireGuardPeer]
+#PublicKey=dPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+#AllowedIPs=
+`
+	path := filepath.Join(t.TempDir(), "wg0.netdev")
+	if err := os.WriteFile(path, []byte(netdev), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newFakeClient(wgtypes.Device{Name: "wg0"})
+	c := &wgconf.Controller{Client: client, Device: "wg0", Source: wgconf.NetDevFile(path)}
+	if err := c.Converge(); err != nil {
+		t.Fatal(err)
+	}
+
+	dev, _ := client.Device("wg0")
+	if len(dev.Peers) != 1 || dev.Peers[0].PublicKey != mustParseKey(public1) {
+		t.Fatalf("unexpected peers on device: %+v", dev.Peers)
+	}
+}
+
+func TestControllerRun(t *testing.T) {
+	desired := wgconf.PeerList{
+		{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+	}
+	data, err := json.Marshal(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "peers.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := make(chan wgconf.ControllerStatus, 1)
+	reload := make(chan os.Signal)
+	c := &wgconf.Controller{
+		Client:   newFakeClient(wgtypes.Device{Name: "wg0"}),
+		Device:   "wg0",
+		Source:   wgconf.JSONFile(path),
+		Interval: time.Hour,
+		Reload:   reload,
+		Report: func(status wgconf.ControllerStatus) {
+			reports <- status
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	if status := <-reports; status.LastError != nil || status.Added != 1 {
+		t.Fatalf("unexpected status after first attempt: %+v", status)
+	}
+
+	// Trigger a reload instead of waiting for the interval
+	reload <- os.Interrupt
+	if status := <-reports; status.LastError != nil || status.Added != 0 {
+		t.Fatalf("unexpected status after reload: %+v", status)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error from cancelled controller: %v", err)
+	}
+}
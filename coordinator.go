@@ -0,0 +1,322 @@
+package wgconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultWorkers is the number of devices reconciled at once by a
+// Coordinator when no other number is specified.
+const DefaultWorkers = 4
+
+// Coordinator reconciles many WireGuard devices concurrently. Work is
+// spread over a bounded pool of workers, and the coordinator guarantees
+// that no two reconciliations run on the same device at the same time,
+// even when it is called from multiple goroutines.
+//
+// The client must be safe for concurrent use by multiple goroutines. A
+// Coordinator must not be copied or have its fields changed after first
+// use.
+//
+// A device operation that is abandoned because its context is done keeps
+// its device and worker reserved until the client returns. A client call
+// that never returns therefore holds its device and worker forever, and
+// every later reconciliation of that device blocks until its own context is
+// done. ReconcileDevice reports this situation with a *BusyError.
+type Coordinator struct {
+	Client Client
+
+	// Workers is the maximum number of devices reconciled at once by the
+	// coordinator, across all of its callers. If zero, DefaultWorkers is
+	// used.
+	Workers int
+
+	// Options are passed to Reconcile for each device.
+	Options ReconcileOptions
+
+	mu      sync.Mutex
+	workers chan struct{}
+	locks   map[string]chan struct{}
+}
+
+// Reconcile updates the peers of every configured device to match the
+// configuration in the same way as ReconcileConfig, reconciling up to
+// Workers devices at once.
+//
+// The results of all devices that were attempted are returned, keyed by
+// device name. If any device fails a *ConfigError is returned. Devices
+// that have not been reconciled when ctx is cancelled or its deadline is
+// exceeded fail with the context's error.
+func (c *Coordinator) Reconcile(ctx context.Context, cfg Config) (map[string]ReconcileResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	devices := cfg.DeviceNames()
+	workers := cap(c.pool())
+	if workers > len(devices) {
+		workers = len(devices)
+	}
+
+	// Feed the devices to the workers
+	work := make(chan string)
+	go func() {
+		defer close(work)
+		for _, device := range devices {
+			work <- device
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]ReconcileResult, len(devices))
+		failed  = make(map[string]error)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for device := range work {
+				result, err := c.ReconcileDevice(ctx, device, cfg.Devices[device])
+				mu.Lock()
+				results[device] = result
+				if err != nil {
+					failed[device] = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return results, &ConfigError{Failed: failed}
+	}
+	return results, nil
+}
+
+// ReconcileDevice collects the current state of a device and updates its
+// interface settings and peers to match the desired configuration. If
+// another reconciliation of the same device is in progress it waits for it
+// to finish first, and it waits for a free worker.
+//
+// If ctx is cancelled or its deadline is exceeded ReconcileDevice returns
+// early, but the device and its worker remain reserved until any device
+// operation that was abandoned has returned. When that is the case the
+// returned error is a *BusyError that wraps the context's error.
+func (c *Coordinator) ReconcileDevice(ctx context.Context, device string, desired DeviceConfig) (ReconcileResult, error) {
+	// Acquire the device before a worker, so that workers are never held
+	// while waiting for a device
+	if err := c.lock(ctx, device); err != nil {
+		return ReconcileResult{}, err
+	}
+	pool := c.pool()
+	select {
+	case pool <- struct{}{}:
+	case <-ctx.Done():
+		c.unlock(device)
+		return ReconcileResult{}, contextError(device, ctx.Err())
+	}
+
+	// Track the calls made on behalf of this reconciliation, so that the
+	// device and worker are only released once every call has returned
+	client := &trackedClient{Client: c.Client, idle: make(chan struct{})}
+	release := func() {
+		<-pool
+		c.unlock(device)
+	}
+
+	result, err := reconcileDevice(ctx, client, device, desired, c.Options)
+
+	idle := client.close()
+	select {
+	case <-idle:
+		release()
+	default:
+		go func() {
+			<-idle
+			release()
+		}()
+		if err != nil {
+			err = &BusyError{Device: device, Err: err}
+		}
+	}
+	return result, err
+}
+
+// MovePeer moves a peer from one device to another in the same way as
+// Config.MovePeerContext, and updates cfg to match. Both devices are
+// reserved for the duration of the move, so it never overlaps with a
+// reconciliation of either device by the coordinator.
+//
+// The devices are reserved in a fixed order, so concurrent moves in
+// opposite directions cannot deadlock. The coordinator does not protect
+// cfg itself: it must not be read or changed by anything else, including a
+// concurrent call to Reconcile, while the move runs.
+func (c *Coordinator) MovePeer(ctx context.Context, cfg *Config, peer Peer, from, to string) error {
+	if from == to {
+		return cfg.MovePeerContext(ctx, c.Client, peer, from, to)
+	}
+
+	devices := []string{from, to}
+	sort.Strings(devices)
+	if err := c.lock(ctx, devices[0]); err != nil {
+		return err
+	}
+	defer c.unlock(devices[0])
+	if err := c.lock(ctx, devices[1]); err != nil {
+		return err
+	}
+	defer c.unlock(devices[1])
+
+	pool := c.pool()
+	select {
+	case pool <- struct{}{}:
+	case <-ctx.Done():
+		return contextError(from, ctx.Err())
+	}
+	defer func() { <-pool }()
+
+	// MovePeerContext never abandons a device operation, so the devices
+	// can be released as soon as it returns
+	return cfg.MovePeerContext(ctx, c.Client, peer, from, to)
+}
+
+// pool returns the channel that limits the number of devices reconciled at
+// once.
+func (c *Coordinator) pool() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers == nil {
+		workers := c.Workers
+		if workers <= 0 {
+			workers = DefaultWorkers
+		}
+		c.workers = make(chan struct{}, workers)
+	}
+	return c.workers
+}
+
+// lock acquires the lock for a device, returning early if ctx is done.
+func (c *Coordinator) lock(ctx context.Context, device string) error {
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = make(map[string]chan struct{})
+	}
+	lock, ok := c.locks[device]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		c.locks[device] = lock
+	}
+	c.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return contextError(device, ctx.Err())
+	}
+}
+
+// unlock releases the lock for a device.
+func (c *Coordinator) unlock(device string) {
+	c.mu.Lock()
+	lock := c.locks[device]
+	c.mu.Unlock()
+	<-lock
+}
+
+// BusyError is returned by Coordinator.ReconcileDevice when it returns
+// while a device operation it abandoned is still in progress. The device
+// and its worker remain reserved until the operation returns, which may be
+// never if the client is stuck.
+type BusyError struct {
+	Device string
+	Err    error
+}
+
+// Error returns a string representation of the error.
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("wgconf: WireGuard device %s remains reserved until an abandoned operation returns: %v", e.Device, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BusyError) Unwrap() error {
+	return e.Err
+}
+
+// errClientClosed is returned by a trackedClient for calls that start after
+// it has been closed.
+var errClientClosed = errors.New("wgconf: device operation started after reconciliation finished")
+
+// trackedClient is a client that counts the calls in progress. Once it has
+// been closed it refuses new calls, so that a call abandoned before it
+// started cannot reach the device after the device has been released.
+type trackedClient struct {
+	Client
+
+	mu     sync.Mutex
+	calls  int
+	closed bool
+	idle   chan struct{}
+}
+
+// Device retrieves a device if the client has not been closed.
+func (t *trackedClient) Device(name string) (*wgtypes.Device, error) {
+	if !t.begin() {
+		return nil, errClientClosed
+	}
+	defer t.end()
+	return t.Client.Device(name)
+}
+
+// ConfigureDevice configures a device if the client has not been closed.
+func (t *trackedClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	if !t.begin() {
+		return errClientClosed
+	}
+	defer t.end()
+	return t.Client.ConfigureDevice(name, cfg)
+}
+
+// close stops the client from accepting new calls. It returns a channel
+// that is closed once every call in progress has returned.
+func (t *trackedClient) close() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		if t.calls == 0 {
+			close(t.idle)
+		}
+	}
+	return t.idle
+}
+
+// begin records the start of a call. It returns false if the client has
+// been closed.
+func (t *trackedClient) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.calls++
+	return true
+}
+
+// end records the end of a call.
+func (t *trackedClient) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls--
+	if t.closed && t.calls == 0 {
+		close(t.idle)
+	}
+}
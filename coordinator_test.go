@@ -0,0 +1,209 @@
+package wgconf_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// trackingClient records the number of calls in flight, both per device
+// and in total.
+type trackingClient struct {
+	*fakeClient
+	delay time.Duration
+
+	mu       sync.Mutex
+	active   map[string]int
+	total    int
+	maxTotal int
+	overlaps int
+}
+
+func (c *trackingClient) enter(name string) {
+	c.mu.Lock()
+	c.active[name]++
+	c.total++
+	if c.active[name] > 1 {
+		c.overlaps++
+	}
+	if c.total > c.maxTotal {
+		c.maxTotal = c.total
+	}
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+}
+
+func (c *trackingClient) leave(name string) {
+	c.mu.Lock()
+	c.active[name]--
+	c.total--
+	c.mu.Unlock()
+}
+
+func (c *trackingClient) Device(name string) (*wgtypes.Device, error) {
+	c.enter(name)
+	defer c.leave(name)
+	return c.fakeClient.Device(name)
+}
+
+func (c *trackingClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	c.enter(name)
+	defer c.leave(name)
+	return c.fakeClient.ConfigureDevice(name, cfg)
+}
+
+func TestCoordinatorReconcile(t *testing.T) {
+	const devices = 12
+
+	var fakeDevices []wgtypes.Device
+	cfg := wgconf.Config{Devices: make(map[string]wgconf.DeviceConfig)}
+	for i := 0; i < devices; i++ {
+		name := fmt.Sprintf("wg%d", i)
+		fakeDevices = append(fakeDevices, wgtypes.Device{Name: name})
+		cfg.Devices[name] = wgconf.DeviceConfig{Peers: wgconf.PeerList{
+			{PublicKey: mustGenerateKey(t), AllowedIPs: []net.IPNet{mustParseIPNet(fmt.Sprintf("10.%d.0.1/32", i))}},
+		}}
+	}
+	client := &trackingClient{fakeClient: newFakeClient(fakeDevices...), delay: time.Millisecond, active: make(map[string]int)}
+	coordinator := &wgconf.Coordinator{Client: client, Workers: 3}
+
+	// Reconcile the same configuration from several goroutines at once
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	results := make([]map[string]wgconf.ReconcileResult, len(errs))
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = coordinator.Reconcile(context.Background(), cfg)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("reconcile %d: %v", i, err)
+		}
+		if len(results[i]) != devices {
+			t.Errorf("reconcile %d: unexpected number of results: %d", i, len(results[i]))
+		}
+	}
+	if client.overlaps > 0 {
+		t.Errorf("device calls overlapped %d time(s)", client.overlaps)
+	}
+	if client.maxTotal > 3 {
+		t.Errorf("too many calls in flight: %d", client.maxTotal)
+	}
+
+	// Each peer must have been added exactly once
+	var added int
+	for _, result := range results {
+		for _, r := range result {
+			added += len(r.Added)
+		}
+	}
+	if added != devices {
+		t.Errorf("unexpected number of added peers: want %d, got %d", devices, added)
+	}
+}
+
+func TestCoordinatorTimeout(t *testing.T) {
+	client := &trackingClient{
+		fakeClient: newFakeClient(wgtypes.Device{Name: "wg0"}),
+		delay:      50 * time.Millisecond,
+		active:     make(map[string]int),
+	}
+	coordinator := &wgconf.Coordinator{Client: client}
+	desired := wgconf.DeviceConfig{Peers: wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+	}}
+
+	// The first reconcile gives up while its device call is in progress
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := coordinator.ReconcileDevice(ctx, "wg0", desired)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	var busy *wgconf.BusyError
+	if !errors.As(err, &busy) || busy.Device != "wg0" {
+		t.Fatalf("expected the device to be reported as busy, got %v", err)
+	}
+
+	// The second must wait for the abandoned call to return
+	if _, err := coordinator.ReconcileDevice(context.Background(), "wg0", desired); err != nil {
+		t.Fatal(err)
+	}
+	if client.overlaps > 0 {
+		t.Errorf("device calls overlapped %d time(s)", client.overlaps)
+	}
+}
+
+func mustGenerateKey(t *testing.T) wgtypes.Key {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.PublicKey()
+}
+
+func TestCoordinatorMovePeer(t *testing.T) {
+	client := &trackingClient{
+		fakeClient: newFakeClient(
+			wgtypes.Device{
+				Name:  "wg-tenant1",
+				Peers: []wgtypes.Peer{{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.1/32")}}},
+			},
+			wgtypes.Device{Name: "wg-tenant2"},
+		),
+		delay:  5 * time.Millisecond,
+		active: make(map[string]int),
+	}
+	coordinator := &wgconf.Coordinator{Client: client}
+
+	moved := wgconf.Peer{Name: "C1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.2.0.1/32")}}
+	cfg := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg-tenant1": {Peers: wgconf.PeerList{
+			{Name: "C1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.1/32")}},
+		}},
+		"wg-tenant2": {},
+	}}
+
+	// Reconcile the destination at the same time, with a result that does
+	// not depend on which finishes first
+	var (
+		wg           sync.WaitGroup
+		reconcileErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, reconcileErr = coordinator.ReconcileDevice(context.Background(), "wg-tenant2", wgconf.DeviceConfig{Peers: wgconf.PeerList{moved}})
+	}()
+	if err := coordinator.MovePeer(context.Background(), &cfg, moved, "wg-tenant1", "wg-tenant2"); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if reconcileErr != nil {
+		t.Fatal(reconcileErr)
+	}
+
+	if client.overlaps > 0 {
+		t.Errorf("device calls overlapped %d time(s)", client.overlaps)
+	}
+	src, _ := client.fakeClient.Device("wg-tenant1")
+	dst, _ := client.fakeClient.Device("wg-tenant2")
+	if len(src.Peers) != 0 || len(dst.Peers) != 1 {
+		t.Fatalf("unexpected peers after move: %d on source, %d on destination", len(src.Peers), len(dst.Peers))
+	}
+	if diff := multilineDiff(testNames(cfg.Devices["wg-tenant2"].Peers), "C1"); diff != "" {
+		t.Errorf("unexpected destination inventory (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,141 @@
+package wgconf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ANSI escape sequences used for colored diffs.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// DiffOptions control the output of Diff.
+type DiffOptions struct {
+	// Color enables ANSI color codes for use in terminals.
+	Color bool
+}
+
+// Diff returns a human-readable summary of the differences between peer
+// lists a and b, as determined by CompareLists.
+//
+// Added peers are prefixed with "+", removed peers with "-" and updated
+// peers with "~". Each updated peer is followed by its field-level changes,
+// such as allowed IP addresses that were added or removed. The summary
+// ends with a line holding the number of peers in each category.
+func Diff(a, b PeerList, opts DiffOptions) string {
+	added, updated, removed, unchanged := CompareLists(a, b)
+
+	// Prepare a map so we can look up the original peers by their public key
+	lookup := make(map[Key]Peer, len(a))
+	for i := len(a) - 1; i >= 0; i-- {
+		lookup[a[i].PublicKey] = a[i]
+	}
+
+	d := differ{color: opts.Color}
+	for _, peer := range added {
+		d.line(ansiGreen, "+ ", peerTitle(peer))
+		if addrs := peer.AllowedIPs.String(); addrs != "" {
+			d.line("", "    ", "AllowedIPs: "+addrs)
+		}
+	}
+	for _, peer := range updated {
+		d.line(ansiYellow, "~ ", peerTitle(peer))
+		d.fields(lookup[peer.PublicKey], peer)
+	}
+	for _, peer := range removed {
+		d.line(ansiRed, "- ", peerTitle(peer))
+	}
+	d.sb.WriteString(fmt.Sprintf("%d added, %d updated, %d removed, %d unchanged\n", len(added), len(updated), len(removed), len(unchanged)))
+
+	return d.sb.String()
+}
+
+type differ struct {
+	sb    strings.Builder
+	color bool
+}
+
+func (d *differ) line(color, prefix, text string) {
+	if d.color && color != "" {
+		d.sb.WriteString(color + prefix + text + ansiReset + "\n")
+	} else {
+		d.sb.WriteString(prefix + text + "\n")
+	}
+}
+
+// fields writes the field-level changes between old and new.
+func (d *differ) fields(old, new Peer) {
+	if old.Name != new.Name {
+		d.line(ansiYellow, "    ~ ", fmt.Sprintf("Name: %q -> %q", old.Name, new.Name))
+	}
+	if old.Description != new.Description {
+		d.line(ansiYellow, "    ~ ", fmt.Sprintf("Description: %q -> %q", old.Description, new.Description))
+	}
+	if old.Disabled != new.Disabled {
+		d.line(ansiYellow, "    ~ ", fmt.Sprintf("Disabled: %t -> %t", old.Disabled, new.Disabled))
+	}
+
+	// Labels
+	for _, key := range old.Labels.Keys() {
+		value, found := new.Labels[key]
+		switch {
+		case !found:
+			d.line(ansiRed, "    - ", fmt.Sprintf("Label %s=%s", key, old.Labels[key]))
+		case value != old.Labels[key]:
+			d.line(ansiYellow, "    ~ ", fmt.Sprintf("Label %s: %q -> %q", key, old.Labels[key], value))
+		}
+	}
+	for _, key := range new.Labels.Keys() {
+		if _, found := old.Labels[key]; !found {
+			d.line(ansiGreen, "    + ", fmt.Sprintf("Label %s=%s", key, new.Labels[key]))
+		}
+	}
+
+	// Allowed IP addresses
+	changed := false
+	for _, ipnet := range new.AllowedIPs {
+		if !containsIPNet(old.AllowedIPs, ipnet) {
+			d.line(ansiGreen, "    + ", "AllowedIPs "+ipnet.String())
+			changed = true
+		}
+	}
+	for _, ipnet := range old.AllowedIPs {
+		if !containsIPNet(new.AllowedIPs, ipnet) {
+			d.line(ansiRed, "    - ", "AllowedIPs "+ipnet.String())
+			changed = true
+		}
+	}
+
+	// If the same networks were merely reordered, show the new order
+	if before, after := old.AllowedIPs.String(), new.AllowedIPs.String(); !changed && before != after {
+		d.line(ansiYellow, "    ~ ", fmt.Sprintf("AllowedIPs: %s -> %s", before, after))
+	}
+}
+
+// peerTitle returns the name and public key of a peer for display.
+func peerTitle(p Peer) string {
+	name := p.Name
+	if name == "" {
+		name = "(unnamed)"
+	}
+	if key := sanitizeKey(p.PublicKey); key != "" {
+		return name + " " + key
+	}
+	return name
+}
+
+// containsIPNet returns true if list contains an IP network equivalent to
+// ipnet.
+func containsIPNet(list AllowedIPs, ipnet net.IPNet) bool {
+	for _, item := range list {
+		if compareIPNet(item, ipnet) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package wgconf_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestDiff(t *testing.T) {
+	a := wgconf.PeerList{
+		{Name: "Keep", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "Change", Description: "old", Labels: wgconf.Labels{"owner": "alice", "team": "ops"}, PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.0.3/32")}},
+		{Name: "Gone", PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.4/32")}},
+	}
+	b := wgconf.PeerList{
+		{Name: "Keep", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "Change", Description: "new", Labels: wgconf.Labels{"owner": "bob", "ticket": "OPS-1"}, PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.1.0/24")}},
+		{PublicKey: mustParseKey(public4), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.5/32")}},
+	}
+
+	want := strings.Join([]string{
+		"+ (unnamed) " + public4,
+		"    AllowedIPs: 10.0.0.5/32",
+		"~ Change " + public2,
+		`    ~ Description: "old" -> "new"`,
+		`    ~ Label owner: "alice" -> "bob"`,
+		"    - Label team=ops",
+		"    + Label ticket=OPS-1",
+		"    + AllowedIPs 10.0.1.0/24",
+		"    - AllowedIPs 10.0.0.3/32",
+		"- Gone " + public3,
+		"1 added, 1 updated, 1 removed, 1 unchanged",
+		"",
+	}, "\n")
+	if diff := multilineDiff(wgconf.Diff(a, b, wgconf.DiffOptions{}), want); diff != "" {
+		t.Fatalf("unexpected plain diff (-want +got):\n%s", diff)
+	}
+
+	colored := wgconf.Diff(a, b, wgconf.DiffOptions{Color: true})
+	if !strings.Contains(colored, "\x1b[31m- Gone "+public3+"\x1b[0m\n") {
+		t.Fatalf("colored diff is missing a red removal:\n%q", colored)
+	}
+}
+
+func TestDiffDisabledAndReordered(t *testing.T) {
+	a := wgconf.PeerList{
+		{Name: "Toggle", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "Reorder", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.0.3/32")}},
+	}
+	b := wgconf.PeerList{
+		{Name: "Toggle", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}, Disabled: true},
+		{Name: "Reorder", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32"), mustParseIPNet("10.0.0.2/32")}},
+	}
+
+	want := strings.Join([]string{
+		"~ Toggle " + public1,
+		"    ~ Disabled: false -> true",
+		"~ Reorder " + public2,
+		"    ~ AllowedIPs: 10.0.0.2/32,10.0.0.3/32 -> 10.0.0.3/32,10.0.0.2/32",
+		"0 added, 2 updated, 0 removed, 0 unchanged",
+		"",
+	}, "\n")
+	if diff := multilineDiff(wgconf.Diff(a, b, wgconf.DiffOptions{}), want); diff != "" {
+		t.Fatalf("unexpected diff (-want +got):\n%s", diff)
+	}
+}
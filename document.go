@@ -0,0 +1,508 @@
+package wgconf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// LineKind identifies the kind of a line in a systemd unit file.
+type LineKind int
+
+// Kinds of lines in a systemd unit file.
+const (
+	BlankLine LineKind = iota
+	CommentLine
+	HeaderLine
+	EntryLine
+)
+
+// Line is a logical line of a systemd unit file. An entry whose value is
+// continued with trailing backslashes spans several physical lines, which
+// are held together in a single Line.
+type Line struct {
+	// Raw is the exact text of the line, including its line terminators.
+	Raw string
+
+	Kind LineKind
+
+	// Key and Value hold the parsed contents of an entry. The value of a
+	// continued entry has its continuations joined with spaces, and any
+	// comments interleaved with them removed.
+	Key   string
+	Value string
+}
+
+// Section is a section of a systemd unit file.
+type Section struct {
+	// Name is the name of the section, without brackets.
+	Name string
+
+	// Comments are the comment lines that immediately precede the section
+	// header, without any blank lines between them.
+	Comments []Line
+
+	// Header is the line holding the section name.
+	Header Line
+
+	// Lines are the lines that follow the section header, up to the
+	// comments of the next section.
+	Lines []Line
+}
+
+// Get returns the value of the last entry with the given key within the
+// section.
+func (s *Section) Get(key string) (value string, ok bool) {
+	for _, line := range s.Lines {
+		if line.Kind == EntryLine && line.Key == key {
+			value, ok = line.Value, true
+		}
+	}
+	return
+}
+
+// Document is a lossless representation of a systemd unit file, such as a
+// netdev file. It preserves comments, blank lines, line continuations,
+// unknown keys and unknown sections, so that a file can be edited in place
+// and written back with minimal changes.
+//
+// The [WireGuardPeer] sections of a document can be read and edited as Peer
+// values. Peers that have been commented out are treated as comments, so
+// disabled peers cannot be added to a document.
+type Document struct {
+	// Preamble holds the lines that precede the first section.
+	Preamble []Line
+
+	Sections []*Section
+
+	// newline is the line terminator used for new lines, if it differs
+	// from "\n".
+	newline string
+}
+
+// ParseDocument parses a systemd unit file. Lines that are not understood
+// are retained as entries with an empty value.
+func ParseDocument(data []byte) *Document {
+	doc := &Document{}
+	if i := bytes.IndexByte(data, '\n'); i > 0 && data[i-1] == '\r' {
+		doc.newline = "\r\n"
+	}
+
+	var (
+		current *Section // The section that lines are being added to
+		pending []Line   // Comments that might precede the next section
+	)
+
+	appendLine := func(line Line) {
+		if current == nil {
+			doc.Preamble = append(doc.Preamble, line)
+		} else {
+			current.Lines = append(current.Lines, line)
+		}
+	}
+	flushPending := func() {
+		for _, line := range pending {
+			appendLine(line)
+		}
+		pending = nil
+	}
+
+	physical := splitLines(string(data))
+	for i := 0; i < len(physical); i++ {
+		raw := physical[i]
+		content := strings.TrimSpace(raw)
+
+		switch {
+		case content == "":
+			flushPending()
+			appendLine(Line{Raw: raw, Kind: BlankLine})
+		case content[0] == '#' || content[0] == ';':
+			pending = append(pending, Line{Raw: raw, Kind: CommentLine})
+		case content[0] == '[' && content[len(content)-1] == ']':
+			current = &Section{
+				Name:     content[1 : len(content)-1],
+				Comments: pending,
+				Header:   Line{Raw: raw, Kind: HeaderLine},
+			}
+			pending = nil
+			doc.Sections = append(doc.Sections, current)
+		default:
+			flushPending()
+
+			// Gather continuation lines, ignoring any comments within them
+			var pieces []string
+			for {
+				piece := strings.TrimSpace(physical[i])
+				comment := len(pieces) > 0 && piece != "" && (piece[0] == '#' || piece[0] == ';')
+				continued := comment || strings.HasSuffix(piece, `\`)
+				switch {
+				case comment:
+				case continued:
+					pieces = append(pieces, strings.TrimSpace(strings.TrimSuffix(piece, `\`)))
+				default:
+					pieces = append(pieces, piece)
+				}
+				if !continued || i+1 >= len(physical) {
+					break
+				}
+				i++
+				raw += physical[i]
+			}
+
+			key, value, _ := strings.Cut(strings.Join(pieces, " "), "=")
+			appendLine(Line{
+				Raw:   raw,
+				Kind:  EntryLine,
+				Key:   strings.TrimSpace(key),
+				Value: strings.TrimSpace(value),
+			})
+		}
+	}
+	flushPending()
+
+	return doc
+}
+
+// splitLines splits s into lines that retain their line terminators.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// Bytes returns the serialized document. An unmodified document is returned
+// byte-for-byte as it was parsed.
+func (doc *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, line := range doc.Preamble {
+		buf.WriteString(line.Raw)
+	}
+	for _, section := range doc.Sections {
+		for _, line := range section.Comments {
+			buf.WriteString(line.Raw)
+		}
+		buf.WriteString(section.Header.Raw)
+		for _, line := range section.Lines {
+			buf.WriteString(line.Raw)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Peers returns the peers held by the [WireGuardPeer] sections of the
+// document.
+func (doc *Document) Peers() (PeerList, error) {
+	var peers PeerList
+	for _, section := range doc.Sections {
+		if section.Name != "WireGuardPeer" {
+			continue
+		}
+		peer, err := sectionPeer(section)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// AddPeer appends a [WireGuardPeer] section for p to the end of the
+// document. It returns an error if p lacks a public key, if p is disabled
+// or if the document already holds a peer with the same key.
+func (doc *Document) AddPeer(p Peer) error {
+	if p.PublicKey == zeroKey {
+		return fmt.Errorf("wgconf: cannot add a peer without a public key")
+	}
+	if p.Disabled {
+		return fmt.Errorf("wgconf: cannot add disabled peer %s", p.PublicKey)
+	}
+	if doc.peerSection(p.PublicKey) >= 0 {
+		return fmt.Errorf("wgconf: peer %s is already present", p.PublicKey)
+	}
+
+	// Make sure the document ends with a terminated line, and separate the
+	// new section from anything before it with a blank line
+	if last := doc.lastLine(); last != nil {
+		if !strings.HasSuffix(last.Raw, "\n") {
+			last.Raw += doc.lineTerminator()
+		}
+		if last.Kind != BlankLine {
+			doc.appendLine(Line{Raw: doc.lineTerminator(), Kind: BlankLine})
+		}
+	}
+
+	section := &Section{
+		Name:     "WireGuardPeer",
+		Comments: doc.commentLines(p),
+		Header:   Line{Raw: "[WireGuardPeer]" + doc.lineTerminator(), Kind: HeaderLine},
+		Lines:    []Line{doc.entryLine("PublicKey", p.PublicKey.String())},
+	}
+	if addrs := p.AllowedIPs.String(); addrs != "" {
+		section.Lines = append(section.Lines, doc.entryLine("AllowedIPs", addrs))
+	}
+	doc.Sections = append(doc.Sections, section)
+
+	return nil
+}
+
+// UpdatePeer updates the [WireGuardPeer] section with the same public key
+// as p. Only the parts of the section that have changed are rewritten.
+// Other comments and entries, such as endpoints or preshared keys, are
+// left intact. It returns false if the peer is not present, and an error if
+// p is disabled.
+func (doc *Document) UpdatePeer(p Peer) (bool, error) {
+	i := doc.peerSection(p.PublicKey)
+	if i < 0 {
+		return false, nil
+	}
+	if p.Disabled {
+		return true, fmt.Errorf("wgconf: cannot update peer %s to be disabled", p.PublicKey)
+	}
+	section := doc.Sections[i]
+	current, err := sectionPeer(section)
+	if err != nil {
+		return true, err
+	}
+
+	// Rewrite the name, description and label comments
+	if current.Name != p.Name || current.Description != p.Description || compareLabels(current.Labels, p.Labels) != 0 {
+		section.Comments = doc.replacePeerComments(section.Comments, p)
+	}
+
+	// Rewrite the allowed IP addresses
+	if !sameIPNets(current.AllowedIPs, p.AllowedIPs) {
+		section.Lines = doc.replaceAllowedIPs(section.Lines, p.AllowedIPs)
+	}
+
+	return true, nil
+}
+
+// RemovePeer removes the [WireGuardPeer] section with the given public key,
+// along with its comments. It returns false if the peer is not present.
+func (doc *Document) RemovePeer(key Key) bool {
+	i := doc.peerSection(key)
+	if i < 0 {
+		return false
+	}
+	doc.Sections = append(doc.Sections[:i], doc.Sections[i+1:]...)
+
+	// Don't leave a dangling blank line at the end of the document
+	if i == len(doc.Sections) {
+		lines := &doc.Preamble
+		if i > 0 {
+			lines = &doc.Sections[i-1].Lines
+		}
+		for n := len(*lines); n > 0 && (*lines)[n-1].Kind == BlankLine; n-- {
+			*lines = (*lines)[:n-1]
+		}
+	}
+
+	return true
+}
+
+// Apply edits the document so that its peers match the given list. Peers
+// are added, updated and removed as determined by CompareLists. Disabled
+// peers are treated as absent, so any section for them is removed.
+func (doc *Document) Apply(peers PeerList) error {
+	current, err := doc.Peers()
+	if err != nil {
+		return err
+	}
+	peers = peers.Match(func(p Peer) bool {
+		return !p.Disabled
+	})
+	added, updated, removed, _ := CompareLists(current, peers)
+	for _, peer := range removed {
+		doc.RemovePeer(peer.PublicKey)
+	}
+	for _, peer := range updated {
+		if _, err := doc.UpdatePeer(peer); err != nil {
+			return err
+		}
+	}
+	for _, peer := range added {
+		if err := doc.AddPeer(peer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peerSection returns the index of the [WireGuardPeer] section with the
+// given public key, or -1 if it is not present.
+func (doc *Document) peerSection(key Key) int {
+	for i, section := range doc.Sections {
+		if section.Name != "WireGuardPeer" {
+			continue
+		}
+		value, _ := section.Get("PublicKey")
+		if k, err := wgtypes.ParseKey(value); err == nil && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// lineTerminator returns the line terminator used for new lines.
+func (doc *Document) lineTerminator() string {
+	if doc.newline == "" {
+		return "\n"
+	}
+	return doc.newline
+}
+
+// lastLine returns the last line of the document, if any.
+func (doc *Document) lastLine() *Line {
+	lines := doc.Preamble
+	if n := len(doc.Sections); n > 0 {
+		section := doc.Sections[n-1]
+		if len(section.Lines) == 0 {
+			return &section.Header
+		}
+		lines = section.Lines
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return &lines[len(lines)-1]
+}
+
+// appendLine appends a line to the end of the document.
+func (doc *Document) appendLine(line Line) {
+	if n := len(doc.Sections); n > 0 {
+		doc.Sections[n-1].Lines = append(doc.Sections[n-1].Lines, line)
+	} else {
+		doc.Preamble = append(doc.Preamble, line)
+	}
+}
+
+func (doc *Document) entryLine(key, value string) Line {
+	return Line{Raw: key + "=" + value + doc.lineTerminator(), Kind: EntryLine, Key: key, Value: value}
+}
+
+func (doc *Document) commentLines(p Peer) []Line {
+	var lines []Line
+	for _, comment := range p.comments() {
+		lines = append(lines, Line{Raw: comment + doc.lineTerminator(), Kind: CommentLine})
+	}
+	return lines
+}
+
+// replacePeerComments replaces the name, description and label comments
+// within comments with those of p. Other comments are retained.
+func (doc *Document) replacePeerComments(comments []Line, p Peer) []Line {
+	// Locate the heading, which is the last comment that isn't a label
+	heading := -1
+	for i, line := range comments {
+		if !isLabelComment(line.Raw) {
+			heading = i
+		}
+	}
+
+	var out []Line
+	for i, line := range comments {
+		if i == heading || isLabelComment(line.Raw) {
+			continue
+		}
+		out = append(out, line)
+	}
+	return append(out, doc.commentLines(p)...)
+}
+
+// replaceAllowedIPs replaces the AllowedIPs entries within lines with a
+// single entry holding ipnets.
+func (doc *Document) replaceAllowedIPs(lines []Line, ipnets AllowedIPs) []Line {
+	addrs := ipnets.String()
+	var (
+		out      []Line
+		replaced bool
+		anchor   = -1
+	)
+	for _, line := range lines {
+		if line.Kind == EntryLine && line.Key == "AllowedIPs" {
+			if !replaced && addrs != "" {
+				out = append(out, doc.entryLine("AllowedIPs", addrs))
+			}
+			replaced = true
+			continue
+		}
+		out = append(out, line)
+		if line.Kind == EntryLine && line.Key == "PublicKey" {
+			anchor = len(out)
+		}
+	}
+	if !replaced && addrs != "" {
+		if anchor < 0 {
+			anchor = len(out)
+		}
+		out = append(out[:anchor], append([]Line{doc.entryLine("AllowedIPs", addrs)}, out[anchor:]...)...)
+	}
+	return out
+}
+
+func isLabelComment(raw string) bool {
+	comment := strings.TrimSpace(raw)
+	if !strings.HasPrefix(comment, labelPrefix) {
+		return false
+	}
+	key, _, found := strings.Cut(strings.TrimPrefix(comment, labelPrefix), "=")
+	return found && key != ""
+}
+
+// sectionPeer returns the peer described by a [WireGuardPeer] section.
+func sectionPeer(section *Section) (Peer, error) {
+	var comments []string
+	for _, line := range section.Comments {
+		comments = append(comments, strings.TrimSpace(line.Raw))
+	}
+
+	var peer Peer
+	applyPeerComments(&peer, comments)
+	for _, line := range section.Lines {
+		if line.Kind != EntryLine {
+			continue
+		}
+		switch line.Key {
+		case "PublicKey":
+			key, err := wgtypes.ParseKey(line.Value)
+			if err != nil {
+				return Peer{}, fmt.Errorf("invalid public key: %v", err)
+			}
+			peer.PublicKey = key
+		case "AllowedIPs":
+			// An empty assignment resets the list
+			if line.Value == "" {
+				peer.AllowedIPs = nil
+				continue
+			}
+			ipnets, err := parseAllowedIPs(line.Value)
+			if err != nil {
+				return Peer{}, err
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, ipnets...)
+		}
+	}
+	return peer, nil
+}
+
+func sameIPNets(a, b AllowedIPs) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if compareIPNet(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package wgconf_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+const testDocument = `# Hub configuration, maintained by hand
+[NetDev]
+Name=wg0
+Kind=wireguard
+Description=Hub \
+  # interleaved comment
+  interface
+
+[WireGuard]
+PrivateKeyFile=/etc/systemd/network/wg0.key
+ListenPort=51820
+
+# P1 (first)
+# Label: owner=alice
+[WireGuardPeer]
+PublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.1/32
+Endpoint=203.0.113.7:51820
+
+; Unknown section
+[X-Custom]
+Foo=bar
+
+# Keep this note
+# P2
+[WireGuardPeer]
+PublicKey=bPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.2/32
+AllowedIPs=10.0.0.3/32
+PersistentKeepalive=25
+`
+
+func TestDocumentLossless(t *testing.T) {
+	doc := wgconf.ParseDocument([]byte(testDocument))
+	if diff := multilineDiff(string(doc.Bytes()), testDocument); diff != "" {
+		t.Fatalf("document did not survive a round trip (-want +got):\n%s", diff)
+	}
+
+	if value, _ := doc.Sections[0].Get("Description"); value != "Hub interface" {
+		t.Errorf("unexpected value for continued entry: %q", value)
+	}
+
+	peers, err := doc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(peers), "P1,P2"); diff != "" {
+		t.Fatalf("unexpected peers (-want +got):\n%s", diff)
+	}
+	if got := peers[1].AllowedIPs.String(); got != "10.0.0.2/32,10.0.0.3/32" {
+		t.Errorf("unexpected allowed IPs for P2: %s", got)
+	}
+	if got := peers[0].Labels["owner"]; got != "alice" {
+		t.Errorf("unexpected owner label for P1: %q", got)
+	}
+}
+
+func TestDocumentApply(t *testing.T) {
+	doc := wgconf.ParseDocument([]byte(testDocument))
+	err := doc.Apply(wgconf.PeerList{
+		{Name: "P1", Description: "first", Labels: wgconf.Labels{"owner": "alice"}, PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32"), mustParseIPNet("10.0.1.0/24")}},
+		{Name: "P2 renamed", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.0.3/32")}},
+		{Name: "P3", PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.4/32")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `# Hub configuration, maintained by hand
+[NetDev]
+Name=wg0
+Kind=wireguard
+Description=Hub \
+  # interleaved comment
+  interface
+
+[WireGuard]
+PrivateKeyFile=/etc/systemd/network/wg0.key
+ListenPort=51820
+
+# P1 (first)
+# Label: owner=alice
+[WireGuardPeer]
+PublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.1/32,10.0.1.0/24
+Endpoint=203.0.113.7:51820
+
+; Unknown section
+[X-Custom]
+Foo=bar
+
+# Keep this note
+# P2 renamed
+[WireGuardPeer]
+PublicKey=bPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.2/32
+AllowedIPs=10.0.0.3/32
+PersistentKeepalive=25
+
+# P3
+[WireGuardPeer]
+PublicKey=cPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.4/32
+`
+	if diff := multilineDiff(string(doc.Bytes()), want); diff != "" {
+		t.Fatalf("unexpected document after applying peers (-want +got):\n%s", diff)
+	}
+
+	if !doc.RemovePeer(mustParseKey(public3)) || !doc.RemovePeer(mustParseKey(public1)) {
+		t.Fatal("failed to remove peers")
+	}
+	if doc.RemovePeer(mustParseKey(public1)) {
+		t.Fatal("removed a peer that was not present")
+	}
+	peers, err := doc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(peers), "P2 renamed"); diff != "" {
+		t.Fatalf("unexpected peers after removal (-want +got):\n%s", diff)
+	}
+}
+
+func TestDocumentDisabledPeers(t *testing.T) {
+	doc := wgconf.ParseDocument([]byte(testDocument))
+	disabled := wgconf.Peer{Name: "P3", PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.4/32")}, Disabled: true}
+	if err := doc.AddPeer(disabled); err == nil {
+		t.Fatal("expected an error when adding a disabled peer")
+	}
+
+	// Disabling a peer removes its section, and applying again is stable
+	peers, err := doc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers[0].Disabled = true
+	if err := doc.Apply(peers); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := doc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(remaining), "P2"); diff != "" {
+		t.Fatalf("unexpected peers after disabling P1 (-want +got):\n%s", diff)
+	}
+	before := string(doc.Bytes())
+	if err := doc.Apply(peers); err != nil {
+		t.Fatal(err)
+	}
+	if after := string(doc.Bytes()); after != before {
+		t.Errorf("applying the same peers again changed the document:\n%s", after)
+	}
+}
@@ -0,0 +1,134 @@
+package wgconf
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dropInPrefix is the prefix of drop-in files that are managed by this
+// package. Files without it are never removed by SyncDropIns.
+const dropInPrefix = "wgconf-"
+
+// DropInName returns the file name of the drop-in for a peer, such as
+// "wgconf-Laptop1-aPxGwq8z.conf".
+//
+// The name is derived from the peer name and a short prefix of its public
+// key, so that it remains stable as long as neither changes. Characters
+// that are unsafe in file names are replaced with dashes. Peers without a
+// name use their full public key.
+func DropInName(p Peer) string {
+	key := ""
+	if p.PublicKey != zeroKey {
+		key = base64.RawURLEncoding.EncodeToString(p.PublicKey[:])
+	}
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, p.Name), "-.")
+
+	switch {
+	case name != "" && key != "":
+		return dropInPrefix + name + "-" + key[:8] + ".conf"
+	case name != "":
+		return dropInPrefix + name + ".conf"
+	default:
+		return dropInPrefix + key + ".conf"
+	}
+}
+
+// SyncDropIns writes each peer to its own drop-in file within dir, such as
+// /etc/systemd/network/wg0.netdev.d. Files are written with WriteFile and
+// are only replaced when their contents change.
+//
+// Drop-in files previously written by SyncDropIns that no longer belong to
+// a peer are removed. Other files in the directory are left alone.
+//
+// It returns the names of the files that were written or removed.
+func SyncDropIns(dir string, peers PeerList, opts WriteOptions) (written, removed []string, err error) {
+	// Determine the file name and contents for each peer
+	files := make(map[string]string, len(peers))
+	for _, peer := range peers {
+		content := peer.NetDev()
+		if content == "" {
+			continue
+		}
+		name := DropInName(peer)
+		if _, duplicate := files[name]; duplicate {
+			return nil, nil, fmt.Errorf("wgconf: more than one peer maps to drop-in %s", name)
+		}
+		files[name] = content + "\n"
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	// Write the drop-ins in a predictable order
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		changed, err := WriteFile(filepath.Join(dir, name), []byte(files[name]), opts)
+		if err != nil {
+			return written, removed, err
+		}
+		if changed {
+			written = append(written, name)
+		}
+	}
+
+	// Remove orphaned drop-ins
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return written, removed, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, dropInPrefix) || !strings.HasSuffix(name, ".conf") {
+			continue
+		}
+		if _, keep := files[name]; keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return written, removed, err
+		}
+		removed = append(removed, name)
+	}
+
+	return written, removed, nil
+}
+
+// ReadDropIns parses every .conf file within dir in lexical order, as
+// systemd does, and returns the peers they contain.
+func ReadDropIns(dir string) (PeerList, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers PeerList
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		list, err := NetDevFile(filepath.Join(dir, entry.Name())).Peers()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		peers = append(peers, list...)
+	}
+	return peers, nil
+}
@@ -0,0 +1,59 @@
+package wgconf_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestSyncDropIns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wg0.netdev.d")
+	p1 := wgconf.Peer{Name: "Alice Smith's laptop", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}}
+	p2 := wgconf.Peer{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}}
+	p3 := wgconf.Peer{Name: "P3", PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32")}}
+
+	if name := wgconf.DropInName(p1); name != "wgconf-Alice-Smith-s-laptop-aPxGwq8z.conf" {
+		t.Errorf("unexpected drop-in name: %s", name)
+	}
+
+	written, removed, err := wgconf.SyncDropIns(dir, wgconf.PeerList{p1, p2, p3}, wgconf.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 3 || len(removed) != 0 {
+		t.Fatalf("unexpected initial sync: written %v, removed %v", written, removed)
+	}
+
+	// Files that aren't ours must survive a sync
+	manual := filepath.Join(dir, "00-manual.conf")
+	if err := os.WriteFile(manual, []byte("[WireGuardPeer]\nPublicKey="+public4+"\nAllowedIPs=10.0.0.4/32\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p1.AllowedIPs = append(p1.AllowedIPs, mustParseIPNet("10.0.1.1/32"))
+	written, removed, err = wgconf.SyncDropIns(dir, wgconf.PeerList{p1, p2}, wgconf.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(strings.Join(written, ","), wgconf.DropInName(p1)); diff != "" {
+		t.Errorf("unexpected written files (-want +got):\n%s", diff)
+	}
+	if diff := multilineDiff(strings.Join(removed, ","), wgconf.DropInName(p3)); diff != "" {
+		t.Errorf("unexpected removed files (-want +got):\n%s", diff)
+	}
+
+	peers, err := wgconf.ReadDropIns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 3 {
+		t.Fatalf("unexpected number of peers read back: %d", len(peers))
+	}
+	if _, updated, _, _ := wgconf.CompareLists(wgconf.PeerList{p1}, peers.Match(wgconf.IPNet(mustParseIPNet("10.0.0.0/16")).Contains)); len(updated) != 0 {
+		t.Errorf("drop-in did not survive a round trip")
+	}
+}
@@ -0,0 +1,80 @@
+package wgconf
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// escapeComment returns a representation of s that is safe to include in a
+// netdev comment. It is reversed by unescapeComment.
+//
+// Characters that could break out of a comment line or that are significant
+// to the peer comment format are percent-encoded as UTF-8 bytes. This
+// includes the percent sign itself, parentheses, square brackets that could
+// be mistaken for a section header, equal signs, non-graphic
+// characters such as newlines, invalid UTF-8 and any leading or trailing
+// spaces. All other characters, including spaces and non-ASCII letters, are
+// written as-is.
+func escapeComment(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		edge := i == 0 || i+size == len(s)
+		if (r == utf8.RuneError && size <= 1) || (r == ' ' && edge) || escapedRune(r) {
+			for _, b := range []byte(s[i : i+size]) {
+				sb.WriteByte('%')
+				sb.WriteByte(upperhex[b>>4])
+				sb.WriteByte(upperhex[b&0x0f])
+			}
+		} else {
+			sb.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+// escapedRune returns true if r must always be escaped in comments.
+func escapedRune(r rune) bool {
+	switch r {
+	case '%', '(', ')', '[', ']', '=':
+		return true
+	}
+	return !unicode.IsGraphic(r)
+}
+
+// unescapeComment reverses the encoding applied by escapeComment. Percent
+// signs that are not followed by two hexadecimal digits are left as-is.
+func unescapeComment(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,149 @@
+package wgconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Interface holds the interface-level settings of a WireGuard device. Nil
+// fields are left unspecified.
+type Interface struct {
+	PrivateKey   *Key
+	ListenPort   *int
+	FirewallMark *int
+}
+
+// newInterface returns the interface settings of a device.
+func newInterface(dev *wgtypes.Device) Interface {
+	privateKey := dev.PrivateKey
+	listenPort := dev.ListenPort
+	firewallMark := dev.FirewallMark
+	return Interface{
+		PrivateKey:   &privateKey,
+		ListenPort:   &listenPort,
+		FirewallMark: &firewallMark,
+	}
+}
+
+// Empty returns true if none of the interface settings are specified.
+func (iface Interface) Empty() bool {
+	return iface.PrivateKey == nil && iface.ListenPort == nil && iface.FirewallMark == nil
+}
+
+// config returns the device configuration that applies the specified
+// interface settings.
+func (iface Interface) config() wgtypes.Config {
+	return wgtypes.Config{
+		PrivateKey:   iface.PrivateKey,
+		ListenPort:   iface.ListenPort,
+		FirewallMark: iface.FirewallMark,
+	}
+}
+
+// CompareInterface returns the settings of desired that differ from
+// current. Nil fields in desired are not managed and are never returned.
+// Nil fields in current are treated as unknown and always differ.
+func CompareInterface(current, desired Interface) Interface {
+	var changes Interface
+	if desired.PrivateKey != nil && (current.PrivateKey == nil || *current.PrivateKey != *desired.PrivateKey) {
+		changes.PrivateKey = desired.PrivateKey
+	}
+	if desired.ListenPort != nil && (current.ListenPort == nil || *current.ListenPort != *desired.ListenPort) {
+		changes.ListenPort = desired.ListenPort
+	}
+	if desired.FirewallMark != nil && (current.FirewallMark == nil || *current.FirewallMark != *desired.FirewallMark) {
+		changes.FirewallMark = desired.FirewallMark
+	}
+	return changes
+}
+
+// CollectInterface returns the current interface settings of a device.
+func CollectInterface(client Client, device string) (Interface, error) {
+	return CollectInterfaceContext(context.Background(), client, device)
+}
+
+// CollectInterfaceContext returns the current interface settings of a
+// device. It returns early if ctx is cancelled or its deadline is exceeded.
+func CollectInterfaceContext(ctx context.Context, client Client, device string) (Interface, error) {
+	dev, err := deviceContext(ctx, client, device)
+	if err != nil {
+		return Interface{}, err
+	}
+	return newInterface(dev), nil
+}
+
+// ReconcileInterface updates the interface settings of a device to match
+// the desired settings. The current settings are collected and compared
+// with CompareInterface, and only the settings that differ are issued. Nil
+// fields in desired are left unchanged.
+//
+// It returns the settings that were changed. Changing the private key also
+// changes the public key of the device.
+func ReconcileInterface(client Client, device string, desired Interface) (Interface, error) {
+	return ReconcileInterfaceContext(context.Background(), client, device, desired)
+}
+
+// ReconcileInterfaceContext updates the interface settings of a device in
+// the same way as ReconcileInterface. It returns early if ctx is cancelled
+// or its deadline is exceeded.
+func ReconcileInterfaceContext(ctx context.Context, client Client, device string, desired Interface) (Interface, error) {
+	if desired.Empty() {
+		return Interface{}, nil
+	}
+	current, err := CollectInterfaceContext(ctx, client, device)
+	if err != nil {
+		return Interface{}, err
+	}
+	changes := CompareInterface(current, desired)
+	if changes.Empty() {
+		return Interface{}, nil
+	}
+	if err := configureContext(ctx, client, device, changes.config()); err != nil {
+		return Interface{}, fmt.Errorf("failed to configure WireGuard device %s: %w", device, err)
+	}
+	return changes, nil
+}
+
+// jsonInterface is the JSON representation of interface settings.
+type jsonInterface struct {
+	PrivateKey   *string `json:"private_key,omitempty"`
+	ListenPort   *int    `json:"listen_port,omitempty"`
+	FirewallMark *int    `json:"firewall_mark,omitempty"`
+}
+
+// MarshalJSON returns a JSON representation of the interface settings. The
+// private key is encoded as a base64 string.
+func (iface Interface) MarshalJSON() ([]byte, error) {
+	v := jsonInterface{
+		ListenPort:   iface.ListenPort,
+		FirewallMark: iface.FirewallMark,
+	}
+	if iface.PrivateKey != nil {
+		key := iface.PrivateKey.String()
+		v.PrivateKey = &key
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON parses a JSON representation of the interface settings.
+func (iface *Interface) UnmarshalJSON(data []byte) error {
+	var v jsonInterface
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*iface = Interface{
+		ListenPort:   v.ListenPort,
+		FirewallMark: v.FirewallMark,
+	}
+	if v.PrivateKey != nil {
+		key, err := wgtypes.ParseKey(*v.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid private key: %v", err)
+		}
+		iface.PrivateKey = &key
+	}
+	return nil
+}
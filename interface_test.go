@@ -0,0 +1,116 @@
+package wgconf_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestCompareInterface(t *testing.T) {
+	key1, key2 := mustParseKey(public1), mustParseKey(public2)
+	port1, port2 := 51820, 51821
+	mark := 42
+
+	current := wgconf.Interface{PrivateKey: &key1, ListenPort: &port1}
+	desired := wgconf.Interface{PrivateKey: &key2, ListenPort: &port1, FirewallMark: &mark}
+
+	changes := wgconf.CompareInterface(current, desired)
+	if changes.PrivateKey == nil || *changes.PrivateKey != key2 {
+		t.Errorf("expected a private key change, got %v", changes.PrivateKey)
+	}
+	if changes.ListenPort != nil {
+		t.Errorf("unexpected listen port change: %d", *changes.ListenPort)
+	}
+	if changes.FirewallMark == nil || *changes.FirewallMark != mark {
+		t.Errorf("expected a firewall mark change, got %v", changes.FirewallMark)
+	}
+
+	// Unmanaged settings are never changed
+	if changes := wgconf.CompareInterface(current, wgconf.Interface{ListenPort: &port2}); changes.PrivateKey != nil || changes.ListenPort == nil {
+		t.Errorf("unexpected changes for a partial interface: %+v", changes)
+	}
+	if changes := wgconf.CompareInterface(current, wgconf.Interface{}); !changes.Empty() {
+		t.Errorf("unexpected changes for an unmanaged interface: %+v", changes)
+	}
+}
+
+func TestReconcileInterface(t *testing.T) {
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := 51820
+	mark := 42
+
+	client := newFakeClient(wgtypes.Device{Name: "wg0", ListenPort: port})
+	desired := wgconf.Interface{PrivateKey: &privateKey, ListenPort: &port, FirewallMark: &mark}
+
+	changes, err := wgconf.ReconcileInterface(client, "wg0", desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.PrivateKey == nil || changes.FirewallMark == nil || changes.ListenPort != nil {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if len(client.calls) != 1 || client.calls[0].ListenPort != nil || len(client.calls[0].Peers) != 0 {
+		t.Fatalf("unexpected configuration calls: %+v", client.calls)
+	}
+
+	dev, _ := client.Device("wg0")
+	if dev.PrivateKey != privateKey || dev.PublicKey != privateKey.PublicKey() || dev.FirewallMark != mark {
+		t.Errorf("interface settings were not applied: %+v", dev)
+	}
+
+	// A second pass has nothing to do
+	changes, err = wgconf.ReconcileInterface(client, "wg0", desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.Empty() || len(client.calls) != 1 {
+		t.Errorf("unexpected changes on second pass: %+v", changes)
+	}
+}
+
+func TestReconcileConfigInterface(t *testing.T) {
+	port := 51821
+	client := newFakeClient(wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		},
+	})
+	cfg := wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+		"wg0": {
+			Interface: wgconf.Interface{ListenPort: &port},
+			Peers: wgconf.PeerList{
+				{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+			},
+		},
+	}}
+
+	results, err := wgconf.ReconcileConfig(client, cfg, wgconf.ReconcileOptions{Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := results["wg0"]
+	if result.Interface.ListenPort == nil || *result.Interface.ListenPort != port {
+		t.Fatalf("expected a listen port change, got %+v", result.Interface)
+	}
+	if dev, _ := client.Device("wg0"); dev.ListenPort != port || len(dev.Peers) != 1 {
+		t.Errorf("unexpected device state: %+v", dev)
+	}
+
+	// The snapshot holds the interface settings from before the change
+	if result.Snapshot == nil || result.Snapshot.Interface.ListenPort == nil || *result.Snapshot.Interface.ListenPort != 51820 {
+		t.Fatalf("snapshot does not hold the previous listen port: %+v", result.Snapshot)
+	}
+	if err := wgconf.Rollback(client, *result.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if dev, _ := client.Device("wg0"); dev.ListenPort != 51820 {
+		t.Errorf("listen port was not rolled back: %d", dev.ListenPort)
+	}
+}
@@ -0,0 +1,32 @@
+package wgconf
+
+// Annotate joins peers that have been collected from a device with the
+// peers in an inventory, such as a parsed netdev file. Peers are matched by
+// their public key.
+//
+// The returned list contains every collected peer. Each peer retains the
+// public key and allowed IP addresses reported by the device, and receives
+// the name, description and labels of its inventory entry. Collected peers
+// that have no inventory entry are also returned in unknown.
+func Annotate(collected, inventory PeerList) (annotated, unknown PeerList) {
+	// Prepare a map so we can look up inventory peers by their public key,
+	// ignoring all but the first entry for each key
+	lookup := make(map[Key]int)
+	for i := len(inventory) - 1; i >= 0; i-- {
+		lookup[inventory[i].PublicKey] = i
+	}
+
+	annotated = make(PeerList, 0, len(collected))
+	for _, peer := range collected {
+		if i, found := lookup[peer.PublicKey]; found {
+			peer.Name = inventory[i].Name
+			peer.Description = inventory[i].Description
+			peer.Labels = inventory[i].Labels
+		} else {
+			unknown = append(unknown, peer)
+		}
+		annotated = append(annotated, peer)
+	}
+
+	return annotated, unknown
+}
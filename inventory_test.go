@@ -0,0 +1,33 @@
+package wgconf_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestAnnotate(t *testing.T) {
+	collected := wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+	}
+	inventory := wgconf.PeerList{
+		{Name: "A1", Description: "first", Labels: wgconf.Labels{"owner": "alice"}, PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.9/32")}},
+		{Name: "A3", PublicKey: mustParseKey(public3)},
+	}
+
+	annotated, unknown := wgconf.Annotate(collected, inventory)
+	if diff := multilineDiff(testNames(annotated), "A1,"); diff != "" {
+		t.Fatalf("unexpected annotated peers (-want +got):\n%s", diff)
+	}
+	if got := annotated[0].AllowedIPs.String(); got != "10.0.0.1/32" {
+		t.Errorf("annotated peer did not retain collected allowed IPs: %s", got)
+	}
+	if got := annotated[0].Labels["owner"]; got != "alice" {
+		t.Errorf("annotated peer did not receive inventory labels: %q", got)
+	}
+	if len(unknown) != 1 || unknown[0].PublicKey != mustParseKey(public2) {
+		t.Errorf("unexpected unknown peers: %v", unknown)
+	}
+}
@@ -0,0 +1,86 @@
+package wgconf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// jsonPeer is the JSON representation of a peer.
+type jsonPeer struct {
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Labels      Labels     `json:"labels,omitempty"`
+	PublicKey   string     `json:"public_key,omitempty"`
+	AllowedIPs  AllowedIPs `json:"allowed_ips,omitempty"`
+	Disabled    bool       `json:"disabled,omitempty"`
+}
+
+// MarshalJSON returns a JSON representation of the peer. The public key is
+// encoded as a base64 string.
+func (p Peer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonPeer{
+		Name:        p.Name,
+		Description: p.Description,
+		Labels:      p.Labels,
+		PublicKey:   sanitizeKey(p.PublicKey),
+		AllowedIPs:  p.AllowedIPs,
+		Disabled:    p.Disabled,
+	})
+}
+
+// UnmarshalJSON parses a JSON representation of the peer.
+func (p *Peer) UnmarshalJSON(data []byte) error {
+	var v jsonPeer
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var key Key
+	if v.PublicKey != "" {
+		var err error
+		if key, err = wgtypes.ParseKey(v.PublicKey); err != nil {
+			return fmt.Errorf("invalid public key: %v", err)
+		}
+	}
+	*p = Peer{
+		Name:        v.Name,
+		Description: v.Description,
+		Labels:      v.Labels,
+		PublicKey:   key,
+		AllowedIPs:  v.AllowedIPs,
+		Disabled:    v.Disabled,
+	}
+	return nil
+}
+
+// MarshalJSON returns a JSON representation of the IP networks as an array
+// of strings in CIDR notation. Invalid networks will be omitted.
+func (ipnets AllowedIPs) MarshalJSON() ([]byte, error) {
+	addrs := make([]string, 0, len(ipnets))
+	for _, ipnet := range ipnets {
+		if !validIP(ipnet.IP) || !validMask(ipnet.Mask) {
+			continue
+		}
+		addrs = append(addrs, ipnet.String())
+	}
+	return json.Marshal(addrs)
+}
+
+// UnmarshalJSON parses an array of strings in CIDR notation.
+func (ipnets *AllowedIPs) UnmarshalJSON(data []byte) error {
+	var addrs []string
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return err
+	}
+	var parsed AllowedIPs
+	for _, addr := range addrs {
+		v, err := parseAllowedIPs(addr)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, v...)
+	}
+	*ipnets = parsed
+	return nil
+}
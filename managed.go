@@ -0,0 +1,122 @@
+package wgconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Markers that delimit the region of a file managed by this package.
+const (
+	ManagedBegin = "# BEGIN wgconf"
+	ManagedEnd   = "# END wgconf"
+)
+
+// Errors returned for files with invalid managed block markers.
+var (
+	ErrMarkerMissing    = errors.New("wgconf: managed block marker is missing")
+	ErrMarkerDuplicated = errors.New("wgconf: managed block marker is duplicated")
+	ErrMarkerOrder      = errors.New("wgconf: managed block end marker precedes begin marker")
+)
+
+// ManagedBlock returns the contents of doc between its managed block
+// markers.
+func ManagedBlock(doc []byte) ([]byte, error) {
+	start, end, err := findManagedBlock(doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc[start:end], nil
+}
+
+// ReplaceManagedBlock returns a copy of doc in which the contents between
+// its managed block markers have been replaced with content. Everything
+// outside of the block, including the markers themselves, is left
+// byte-for-byte intact.
+//
+// An error is returned if either marker is missing or appears more than
+// once, or if the markers are out of order.
+func ReplaceManagedBlock(doc []byte, content string) ([]byte, error) {
+	start, end, err := findManagedBlock(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(doc) - (end - start) + len(content) + 1)
+	out.Write(doc[:start])
+	if content != "" {
+		out.WriteString(content)
+		if content[len(content)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	out.Write(doc[end:])
+	return out.Bytes(), nil
+}
+
+// WriteManagedNetDev replaces the managed block of the netdev file at path
+// with the configuration for peers. The peers are separated from the
+// markers by blank lines, so that the markers are not mistaken for peer
+// comments. The file is written with WriteFile, and it reports whether the
+// file was changed.
+//
+// The file must already exist and contain a single pair of managed block
+// markers.
+func WriteManagedNetDev(path string, peers PeerList, opts WriteOptions) (changed bool, err error) {
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	content := peers.NetDev()
+	if content != "" {
+		content = "\n" + content + "\n\n"
+	}
+	updated, err := ReplaceManagedBlock(doc, content)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return WriteFile(path, updated, opts)
+}
+
+// findManagedBlock returns the byte offsets of the contents between the
+// managed block markers in doc. The start offset immediately follows the
+// begin marker's line, and the end offset is the start of the end marker's
+// line.
+func findManagedBlock(doc []byte) (start, end int, err error) {
+	start, end = -1, -1
+	offset, number := 0, 0
+	for offset < len(doc) {
+		number++
+		next := len(doc)
+		if i := bytes.IndexByte(doc[offset:], '\n'); i >= 0 {
+			next = offset + i + 1
+		}
+		line := string(bytes.TrimSpace(doc[offset:next]))
+		switch line {
+		case ManagedBegin:
+			if start >= 0 {
+				return 0, 0, fmt.Errorf("line %d: %w: %s", number, ErrMarkerDuplicated, ManagedBegin)
+			}
+			start = next
+		case ManagedEnd:
+			if end >= 0 {
+				return 0, 0, fmt.Errorf("line %d: %w: %s", number, ErrMarkerDuplicated, ManagedEnd)
+			}
+			if start < 0 {
+				return 0, 0, fmt.Errorf("line %d: %w", number, ErrMarkerOrder)
+			}
+			end = offset
+		}
+		offset = next
+	}
+
+	switch {
+	case start < 0:
+		return 0, 0, fmt.Errorf("%w: %s", ErrMarkerMissing, ManagedBegin)
+	case end < 0:
+		return 0, 0, fmt.Errorf("%w: %s", ErrMarkerMissing, ManagedEnd)
+	}
+	return start, end, nil
+}
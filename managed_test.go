@@ -0,0 +1,101 @@
+package wgconf_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestReplaceManagedBlock(t *testing.T) {
+	const doc = "[NetDev]\r\nName=wg0\r\nKind=wireguard\r\n\r\n# Hub peer\n[WireGuardPeer]\nPublicKey=cPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.255.0.0/16\n\n# BEGIN wgconf\nstale content\n# END wgconf\n  trailing  "
+
+	peers := wgconf.PeerList{
+		{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+	}
+	updated, err := wgconf.ReplaceManagedBlock([]byte(doc), peers.NetDev())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "[NetDev]\r\nName=wg0\r\nKind=wireguard\r\n\r\n# Hub peer\n[WireGuardPeer]\nPublicKey=cPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.255.0.0/16\n\n# BEGIN wgconf\n# P1\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.1/32\n# END wgconf\n  trailing  "
+	if diff := multilineDiff(string(updated), want); diff != "" {
+		t.Fatalf("unexpected document (-want +got):\n%s", diff)
+	}
+
+	block, err := wgconf.ManagedBlock(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(string(block), peers.NetDev()+"\n"); diff != "" {
+		t.Fatalf("unexpected managed block (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplaceManagedBlockErrors(t *testing.T) {
+	tests := []struct {
+		Name string
+		Doc  string
+		Err  error
+	}{
+		{"MissingBoth", "[NetDev]\n", wgconf.ErrMarkerMissing},
+		{"MissingEnd", "# BEGIN wgconf\n", wgconf.ErrMarkerMissing},
+		{"MissingBegin", "# END wgconf\n", wgconf.ErrMarkerOrder},
+		{"DuplicateBegin", "# BEGIN wgconf\n# BEGIN wgconf\n# END wgconf\n", wgconf.ErrMarkerDuplicated},
+		{"DuplicateEnd", "# BEGIN wgconf\n# END wgconf\n# END wgconf\n", wgconf.ErrMarkerDuplicated},
+		{"Reversed", "# END wgconf\n# BEGIN wgconf\n", wgconf.ErrMarkerOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if _, err := wgconf.ReplaceManagedBlock([]byte(tt.Doc), "x"); !errors.Is(err, tt.Err) {
+				t.Fatalf("unexpected error: want %v, got %v", tt.Err, err)
+			}
+		})
+	}
+}
+
+func TestWriteManagedNetDevRoundTrip(t *testing.T) {
+	const doc = "[NetDev]\nName=wg0\nKind=wireguard\n\n# BEGIN wgconf\n# END wgconf\n"
+	path := filepath.Join(t.TempDir(), "wg0.netdev")
+	if err := os.WriteFile(path, []byte(doc), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	peers := wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{Name: "P2", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+	}
+	if _, err := wgconf.WriteManagedNetDev(path, peers, wgconf.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := wgconf.NetDevFile(path).Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(peers) {
+		t.Fatalf("unexpected number of parsed peers: want %d, got %d", len(peers), len(parsed))
+	}
+	for i := range peers {
+		if wgconf.Compare(peers[i], parsed[i]) != 0 {
+			t.Errorf("peer %d did not survive a round trip: got name %q", i, parsed[i].Name)
+		}
+	}
+
+	// Markers directly adjacent to peers are not treated as peer comments
+	updated, err := wgconf.ReplaceManagedBlock([]byte(doc), peers.NetDev())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = wgconf.ParseNetDev(strings.NewReader(string(updated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(peers) || parsed[0].Name != "" {
+		t.Errorf("managed block marker was treated as a peer comment: %+v", parsed)
+	}
+}
@@ -0,0 +1,192 @@
+package wgconf
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// ConflictKind identifies a kind of merge conflict.
+type ConflictKind int
+
+// Kinds of merge conflicts.
+const (
+	// EditConflict indicates that both sides changed or added the same peer
+	// in different ways.
+	EditConflict ConflictKind = iota
+
+	// DeleteConflict indicates that one side deleted a peer that the other
+	// side updated.
+	DeleteConflict
+
+	// AllowedIPConflict indicates that different peers in the merged list
+	// claim the same allowed IP network.
+	AllowedIPConflict
+)
+
+// String returns a string representation of the conflict kind.
+func (k ConflictKind) String() string {
+	switch k {
+	case EditConflict:
+		return "edit"
+	case DeleteConflict:
+		return "delete"
+	case AllowedIPConflict:
+		return "allowed IP"
+	default:
+		return "unknown"
+	}
+}
+
+// MergeConflict describes a conflict encountered by MergeLists.
+type MergeConflict struct {
+	Kind ConflictKind
+
+	// Base, Ours and Theirs hold each version of the conflicting peer for
+	// edit and delete conflicts. They are nil when the peer is absent from
+	// that version.
+	Base, Ours, Theirs *Peer
+
+	// AllowedIP and Peers hold the contested network and the peers that
+	// claim it for allowed IP conflicts.
+	AllowedIP net.IPNet
+	Peers     PeerList
+}
+
+// String returns a description of the conflict.
+func (c MergeConflict) String() string {
+	switch c.Kind {
+	case AllowedIPConflict:
+		var titles []string
+		for _, peer := range c.Peers {
+			titles = append(titles, peerTitle(peer))
+		}
+		return fmt.Sprintf("%s conflict: %s is claimed by %q", c.Kind, c.AllowedIP.String(), titles)
+	default:
+		var peer Peer
+		switch {
+		case c.Ours != nil:
+			peer = *c.Ours
+		case c.Theirs != nil:
+			peer = *c.Theirs
+		case c.Base != nil:
+			peer = *c.Base
+		}
+		return fmt.Sprintf("%s conflict: %s", c.Kind, peerTitle(peer))
+	}
+}
+
+// MergeLists performs a three-way merge of peer lists. Base is the common
+// ancestor of ours and theirs. Peers are uniquely identified by their public
+// key, as in CompareLists.
+//
+// Changes made on only one side are accepted. When both sides change or add
+// the same peer differently, an edit conflict is reported and our version
+// is kept. When one side deletes a peer that the other side updates, a
+// delete conflict is reported and the updated version is kept. Finally,
+// different peers in the merged list that claim the same allowed IP network
+// are reported as allowed IP conflicts.
+//
+// The merged list is sorted.
+func MergeLists(base, ours, theirs PeerList) (merged PeerList, conflicts []MergeConflict) {
+	b, o, t := peerIndex(base), peerIndex(ours), peerIndex(theirs)
+
+	// Collect every public key in a stable order
+	var keys []Key
+	seen := make(map[Key]bool)
+	for _, list := range []PeerList{ours, theirs, base} {
+		for _, peer := range list {
+			if !seen[peer.PublicKey] {
+				seen[peer.PublicKey] = true
+				keys = append(keys, peer.PublicKey)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		bp, op, tp := b[key], o[key], t[key]
+		conflict := func(kind ConflictKind) {
+			conflicts = append(conflicts, MergeConflict{Kind: kind, Base: bp, Ours: op, Theirs: tp})
+		}
+		changed := func(p *Peer) bool {
+			switch {
+			case p == nil && bp == nil:
+				return false
+			case p == nil || bp == nil:
+				return true
+			default:
+				return Compare(*p, *bp) != 0
+			}
+		}
+
+		switch {
+		case op == nil && tp == nil:
+			// Deleted on both sides
+		case op != nil && tp != nil && Compare(*op, *tp) == 0:
+			merged = append(merged, *op)
+		case !changed(tp):
+			if op != nil {
+				merged = append(merged, *op)
+			}
+		case !changed(op):
+			if tp != nil {
+				merged = append(merged, *tp)
+			}
+		case op == nil:
+			conflict(DeleteConflict)
+			merged = append(merged, *tp)
+		case tp == nil:
+			conflict(DeleteConflict)
+			merged = append(merged, *op)
+		default:
+			conflict(EditConflict)
+			merged = append(merged, *op)
+		}
+	}
+
+	sort.Sort(merged)
+
+	conflicts = append(conflicts, allowedIPConflicts(merged)...)
+
+	return merged, conflicts
+}
+
+// peerIndex returns a map of peers by public key. When duplicate entries
+// are present, all but the first are ignored.
+func peerIndex(list PeerList) map[Key]*Peer {
+	index := make(map[Key]*Peer, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		index[list[i].PublicKey] = &list[i]
+	}
+	return index
+}
+
+// allowedIPConflicts returns a conflict for each allowed IP network that is
+// claimed by more than one peer.
+func allowedIPConflicts(list PeerList) []MergeConflict {
+	var conflicts []MergeConflict
+	claims := make(map[string]int)
+	for _, peer := range list {
+		for _, ipnet := range peer.AllowedIPs {
+			network := (&net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}).String()
+			i, found := claims[network]
+			if !found {
+				claims[network] = len(conflicts)
+				conflicts = append(conflicts, MergeConflict{Kind: AllowedIPConflict, AllowedIP: ipnet})
+				i = len(conflicts) - 1
+			}
+			if n := len(conflicts[i].Peers); n == 0 || conflicts[i].Peers[n-1].PublicKey != peer.PublicKey {
+				conflicts[i].Peers = append(conflicts[i].Peers, peer)
+			}
+		}
+	}
+
+	// Only networks claimed by more than one peer are conflicts
+	out := conflicts[:0]
+	for _, conflict := range conflicts {
+		if len(conflict.Peers) > 1 {
+			out = append(out, conflict)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package wgconf_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestMergeLists(t *testing.T) {
+	peer := func(name, key, ip string) wgconf.Peer {
+		return wgconf.Peer{Name: name, PublicKey: mustParseKey(key), AllowedIPs: []net.IPNet{mustParseIPNet(ip)}}
+	}
+
+	base := wgconf.PeerList{
+		peer("Same", public1, "10.0.0.1/32"),
+		peer("OursEdit", public2, "10.0.0.2/32"),
+		peer("BothEdit", public3, "10.0.0.3/32"),
+		peer("DeleteUpdate", public4, "10.0.0.4/32"),
+		peer("BothDelete", public5, "10.0.0.5/32"),
+	}
+	ours := wgconf.PeerList{
+		peer("Same", public1, "10.0.0.1/32"),
+		peer("OursEdit", public2, "10.0.0.22/32"),
+		peer("BothEdit-Ours", public3, "10.0.0.3/32"),
+		peer("OursNew", public6, "10.0.0.6/32"),
+	}
+	theirs := wgconf.PeerList{
+		peer("Same", public1, "10.0.0.1/32"),
+		peer("OursEdit", public2, "10.0.0.2/32"),
+		peer("BothEdit-Theirs", public3, "10.0.0.3/32"),
+		peer("DeleteUpdate-Theirs", public4, "10.0.0.4/32"),
+		peer("TheirsNew", public7, "10.0.0.6/32"),
+	}
+
+	merged, conflicts := wgconf.MergeLists(base, ours, theirs)
+
+	if diff := multilineDiff(testNames(merged), "Same,BothEdit-Ours,DeleteUpdate-Theirs,OursNew,TheirsNew,OursEdit"); diff != "" {
+		t.Errorf("unexpected merged peers (-want +got):\n%s", diff)
+	}
+
+	var got []string
+	for _, conflict := range conflicts {
+		got = append(got, conflict.String())
+	}
+	want := strings.Join([]string{
+		"edit conflict: BothEdit-Ours " + public3,
+		"delete conflict: DeleteUpdate-Theirs " + public4,
+		`allowed IP conflict: 10.0.0.6/32 is claimed by ["OursNew ` + public6 + `" "TheirsNew ` + public7 + `"]`,
+	}, "\n")
+	if diff := multilineDiff(strings.Join(got, "\n"), want); diff != "" {
+		t.Errorf("unexpected conflicts (-want +got):\n%s", diff)
+	}
+}
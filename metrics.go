@@ -0,0 +1,130 @@
+package wgconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MetricsHandler is an HTTP handler that exposes per-peer WireGuard metrics
+// in the Prometheus text exposition format. Device state is collected each
+// time the handler is invoked.
+type MetricsHandler struct {
+	// Client is used to collect device state.
+	Client Client
+
+	// Devices is the set of WireGuard devices to collect.
+	Devices []string
+
+	// Inventory, if provided, supplies the name and description labels of
+	// each peer.
+	Inventory PeerList
+
+	// Now, if non-nil, returns the current time. It is used to compute the
+	// time since the last handshake.
+	Now func() time.Time
+}
+
+// ServeHTTP collects the state of each device and writes its metrics to w.
+func (h MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+
+	// Collect the state of every device before writing anything, so that
+	// failures can be reported with an appropriate status code
+	states := make([]PeerStatusList, len(h.Devices))
+	for i, device := range h.Devices {
+		statuses, err := CollectPeerStatusContext(r.Context(), h.Client, device)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect WireGuard device %s: %v", device, err), http.StatusInternalServerError)
+			return
+		}
+		states[i] = statuses.Annotate(h.Inventory)
+	}
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, h.Devices, states, now)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// peerMetric describes a per-peer metric.
+type peerMetric struct {
+	Name  string
+	Type  string
+	Help  string
+	Value func(status PeerStatus, now time.Time) (value float64, ok bool)
+}
+
+var peerMetrics = []peerMetric{
+	{
+		Name: "wireguard_peer_receive_bytes_total",
+		Type: "counter",
+		Help: "Number of bytes received from the peer.",
+		Value: func(status PeerStatus, now time.Time) (float64, bool) {
+			return float64(status.ReceiveBytes), true
+		},
+	},
+	{
+		Name: "wireguard_peer_transmit_bytes_total",
+		Type: "counter",
+		Help: "Number of bytes transmitted to the peer.",
+		Value: func(status PeerStatus, now time.Time) (float64, bool) {
+			return float64(status.TransmitBytes), true
+		},
+	},
+	{
+		Name: "wireguard_peer_last_handshake_age_seconds",
+		Type: "gauge",
+		Help: "Number of seconds since the last handshake with the peer. Omitted for peers that have never completed a handshake.",
+		Value: func(status PeerStatus, now time.Time) (float64, bool) {
+			if !status.HasHandshake() {
+				return 0, false
+			}
+			return now.Sub(status.LastHandshake).Seconds(), true
+		},
+	},
+	{
+		Name: "wireguard_peer_allowed_ips",
+		Type: "gauge",
+		Help: "Number of allowed IP networks assigned to the peer.",
+		Value: func(status PeerStatus, now time.Time) (float64, bool) {
+			return float64(len(status.AllowedIPs)), true
+		},
+	},
+}
+
+func writeMetrics(w io.Writer, devices []string, states []PeerStatusList, now time.Time) {
+	for _, metric := range peerMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.Name, metric.Help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.Name, metric.Type)
+		for i, device := range devices {
+			for _, status := range states[i] {
+				value, ok := metric.Value(status, now)
+				if !ok {
+					continue
+				}
+				fmt.Fprintf(w, "%s{device=\"%s\",public_key=\"%s\",name=\"%s\",description=\"%s\"} %g\n",
+					metric.Name,
+					escapeLabelValue(device),
+					escapeLabelValue(sanitizeKey(status.PublicKey)),
+					escapeLabelValue(status.Name),
+					escapeLabelValue(status.Description),
+					value)
+			}
+		}
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a Prometheus label value.
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
@@ -0,0 +1,68 @@
+package wgconf_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	client := newFakeClient(wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:         mustParseKey(public1),
+				LastHandshakeTime: now.Add(-90 * time.Second),
+				ReceiveBytes:      1024,
+				TransmitBytes:     2048,
+				AllowedIPs:        []net.IPNet{mustParseIPNet("10.0.0.1/32"), mustParseIPNet("10.0.1.0/24")},
+			},
+			{
+				PublicKey: mustParseKey(public2),
+			},
+		},
+	})
+
+	handler := wgconf.MetricsHandler{
+		Client:    client,
+		Devices:   []string{"wg0"},
+		Inventory: wgconf.PeerList{{Name: "Laptop1", Description: `alice "the admin"`, PublicKey: mustParseKey(public1)}},
+		Now:       func() time.Time { return now },
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`wireguard_peer_receive_bytes_total{device="wg0",public_key="` + public1 + `",name="Laptop1",description="alice \"the admin\""} 1024`,
+		`wireguard_peer_transmit_bytes_total{device="wg0",public_key="` + public1 + `",name="Laptop1",description="alice \"the admin\""} 2048`,
+		`wireguard_peer_last_handshake_age_seconds{device="wg0",public_key="` + public1 + `",name="Laptop1",description="alice \"the admin\""} 90`,
+		`wireguard_peer_allowed_ips{device="wg0",public_key="` + public1 + `",name="Laptop1",description="alice \"the admin\""} 2`,
+		`wireguard_peer_allowed_ips{device="wg0",public_key="` + public2 + `",name="",description=""} 0`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics output is missing %s\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `wireguard_peer_last_handshake_age_seconds{device="wg0",public_key="`+public2) {
+		t.Errorf("metrics output includes a handshake age for a peer without a handshake")
+	}
+
+	handler.Devices = []string{"wg1"}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status code for a missing device: %d", rec.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// MovePeer moves a peer from one device to another and updates the
+// configuration to match.
+//
+// The peer is identified by its public key. It is configured on the
+// destination device with the allowed IP addresses of peer, and with the
+// preshared key, endpoint and keepalive interval it currently has on the
+// source device. The inventory entry for the peer is removed from the
+// source device's peers and peer is added to the destination device's
+// peers.
+//
+// Two devices cannot be changed in a single operation, so the peer is
+// added to the destination before it is removed from the source. There is
+// a brief window in which both devices hold the peer, but never one in
+// which neither does. If the peer cannot be removed from the source, the
+// destination is restored to its previous state and the configuration is
+// left unchanged.
+//
+// MovePeer does not coordinate with other goroutines. The configuration
+// must not be read or changed by anything else while the move runs, and
+// nothing else may reconcile either device in the meantime. Use
+// Coordinator.MovePeer to move a peer between devices that are managed by
+// a Coordinator.
+func (c *Config) MovePeer(client Client, peer Peer, from, to string) error {
+	return c.MovePeerContext(context.Background(), client, peer, from, to)
+}
+
+// MovePeerContext moves a peer from one device to another in the same way
+// as MovePeer. The context is checked before each step. If ctx is cancelled
+// or its deadline is exceeded after the peer has been added to the
+// destination, the destination is restored and an error wrapping the
+// context's error is returned.
+//
+// Unlike other context-aware functions, MovePeerContext never abandons a
+// device operation that is in progress. An abandoned operation could still
+// take effect after the destination was restored, leaving the peer on
+// neither device.
+func (c *Config) MovePeerContext(ctx context.Context, client Client, peer Peer, from, to string) error {
+	if from == to {
+		return fmt.Errorf("wgconf: cannot move peer %s from WireGuard device %s to itself", peer.PublicKey, from)
+	}
+	for _, device := range []string{from, to} {
+		if _, ok := c.Devices[device]; !ok {
+			return fmt.Errorf("wgconf: WireGuard device %s is not configured", device)
+		}
+	}
+
+	// Find the peer on the source device
+	if err := ctx.Err(); err != nil {
+		return contextError(from, err)
+	}
+	src, err := client.Device(from)
+	if err != nil {
+		return fmt.Errorf("wgconf: failed to collect WireGuard device %s: %w", from, err)
+	}
+	current := findPeer(src.Peers, peer.PublicKey)
+	if current == nil {
+		return fmt.Errorf("wgconf: peer %s is not present on WireGuard device %s", peer.PublicKey, from)
+	}
+
+	// Record the state of the destination so that it can be restored
+	if err := ctx.Err(); err != nil {
+		return contextError(to, err)
+	}
+	dst, err := client.Device(to)
+	if err != nil {
+		return fmt.Errorf("wgconf: failed to collect WireGuard device %s: %w", to, err)
+	}
+	previous := findPeer(dst.Peers, peer.PublicKey)
+
+	// Add the peer to the destination
+	if err := ctx.Err(); err != nil {
+		return contextError(to, err)
+	}
+	add := recreatePeerConfig(*current)
+	add.AllowedIPs = peer.AllowedIPs
+	if err := client.ConfigureDevice(to, wgtypes.Config{Peers: []wgtypes.PeerConfig{add}}); err != nil {
+		return fmt.Errorf("wgconf: failed to add peer %s to WireGuard device %s: %w", peer.PublicKey, to, err)
+	}
+
+	// Remove the peer from the source, restoring the destination if that
+	// isn't possible
+	err = ctx.Err()
+	if err != nil {
+		err = contextError(from, err)
+	} else {
+		remove := wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true}
+		if err = client.ConfigureDevice(from, wgtypes.Config{Peers: []wgtypes.PeerConfig{remove}}); err != nil {
+			err = fmt.Errorf("wgconf: failed to remove peer %s from WireGuard device %s: %w", peer.PublicKey, from, err)
+		}
+	}
+	if err != nil {
+		restore := wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true}
+		if previous != nil {
+			restore = recreatePeerConfig(*previous)
+		}
+		if rerr := client.ConfigureDevice(to, wgtypes.Config{Peers: []wgtypes.PeerConfig{restore}}); rerr != nil {
+			return fmt.Errorf("%w (failed to restore WireGuard device %s: %v)", err, to, rerr)
+		}
+		return err
+	}
+
+	// Update the inventory of both devices
+	source := c.Devices[from]
+	source.Peers = source.Peers.Match(func(p Peer) bool {
+		return p.PublicKey != peer.PublicKey
+	})
+	c.Devices[from] = source
+
+	destination := c.Devices[to]
+	destination.Peers = append(destination.Peers.Match(func(p Peer) bool {
+		return p.PublicKey != peer.PublicKey
+	}), peer)
+	c.Devices[to] = destination
+
+	return nil
+}
+
+// findPeer returns the peer with the given public key, or nil if it is not
+// present.
+func findPeer(peers []wgtypes.Peer, key Key) *wgtypes.Peer {
+	for i := range peers {
+		if peers[i].PublicKey == key {
+			return &peers[i]
+		}
+	}
+	return nil
+}
+
+// recreatePeerConfig returns a configuration that recreates peer exactly.
+func recreatePeerConfig(peer wgtypes.Peer) wgtypes.PeerConfig {
+	presharedKey := peer.PresharedKey
+	keepalive := peer.PersistentKeepaliveInterval
+	return wgtypes.PeerConfig{
+		PublicKey:                   peer.PublicKey,
+		PresharedKey:                &presharedKey,
+		Endpoint:                    peer.Endpoint,
+		PersistentKeepaliveInterval: &keepalive,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  peer.AllowedIPs,
+	}
+}
@@ -0,0 +1,135 @@
+package wgconf_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// slowClient delays configuration calls for one device.
+type slowClient struct {
+	*fakeClient
+	device string
+	delay  time.Duration
+}
+
+func (c slowClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	if name == c.device {
+		time.Sleep(c.delay)
+	}
+	return c.fakeClient.ConfigureDevice(name, cfg)
+}
+
+func TestConfigMovePeer(t *testing.T) {
+	endpoint := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}
+	newClient := func() *fakeClient {
+		return newFakeClient(
+			wgtypes.Device{
+				Name: "wg-tenant1",
+				Peers: []wgtypes.Peer{{
+					PublicKey:                   mustParseKey(public1),
+					Endpoint:                    endpoint,
+					PersistentKeepaliveInterval: 25 * time.Second,
+					AllowedIPs:                  []net.IPNet{mustParseIPNet("10.1.0.1/32")},
+				}},
+			},
+			wgtypes.Device{Name: "wg-tenant2"},
+		)
+	}
+	newConfig := func() wgconf.Config {
+		return wgconf.Config{Devices: map[string]wgconf.DeviceConfig{
+			"wg-tenant1": {Peers: wgconf.PeerList{
+				{Name: "C1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.1.0.1/32")}},
+			}},
+			"wg-tenant2": {},
+		}}
+	}
+	moved := wgconf.Peer{Name: "C1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.2.0.1/32")}}
+
+	t.Run("Success", func(t *testing.T) {
+		client, cfg := newClient(), newConfig()
+		if err := cfg.MovePeer(client, moved, "wg-tenant1", "wg-tenant2"); err != nil {
+			t.Fatal(err)
+		}
+
+		src, _ := client.Device("wg-tenant1")
+		dst, _ := client.Device("wg-tenant2")
+		if len(src.Peers) != 0 || len(dst.Peers) != 1 {
+			t.Fatalf("unexpected peers after move: %d on source, %d on destination", len(src.Peers), len(dst.Peers))
+		}
+		if got := dst.Peers[0]; got.Endpoint.String() != endpoint.String() || got.PersistentKeepaliveInterval != 25*time.Second {
+			t.Errorf("peer settings were not moved: %+v", got)
+		}
+		if got := wgconf.AllowedIPs(dst.Peers[0].AllowedIPs).String(); got != "10.2.0.1/32" {
+			t.Errorf("unexpected allowed IPs on destination: %s", got)
+		}
+
+		if n := len(cfg.Devices["wg-tenant1"].Peers); n != 0 {
+			t.Errorf("unexpected number of peers in source inventory: %d", n)
+		}
+		if diff := multilineDiff(testNames(cfg.Devices["wg-tenant2"].Peers), "C1"); diff != "" {
+			t.Errorf("unexpected destination inventory (-want +got):\n%s", diff)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("configuration is invalid after move: %v", err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		client, cfg := newClient(), newConfig()
+		errRemove := errors.New("remove failed")
+		client.configErr = func(name string, cfg wgtypes.Config) error {
+			if name == "wg-tenant1" {
+				return errRemove
+			}
+			return nil
+		}
+
+		if err := cfg.MovePeer(client, moved, "wg-tenant1", "wg-tenant2"); !errors.Is(err, errRemove) {
+			t.Fatalf("expected the removal error, got %v", err)
+		}
+
+		src, _ := client.Device("wg-tenant1")
+		dst, _ := client.Device("wg-tenant2")
+		if len(src.Peers) != 1 || len(dst.Peers) != 0 {
+			t.Fatalf("destination was not rolled back: %d on source, %d on destination", len(src.Peers), len(dst.Peers))
+		}
+		if len(cfg.Devices["wg-tenant1"].Peers) != 1 || len(cfg.Devices["wg-tenant2"].Peers) != 0 {
+			t.Errorf("inventory changed after a failed move")
+		}
+	})
+	// A short deadline must never leave the peer on neither device
+	for _, slow := range []string{"wg-tenant1", "wg-tenant2"} {
+		t.Run("Deadline/"+slow, func(t *testing.T) {
+			client, cfg := newClient(), newConfig()
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			slowed := slowClient{fakeClient: client, device: slow, delay: 50 * time.Millisecond}
+			err := cfg.MovePeerContext(ctx, slowed, moved, "wg-tenant1", "wg-tenant2")
+
+			// Give any call still in progress time to take effect
+			time.Sleep(2 * slowed.delay)
+
+			src, _ := client.Device("wg-tenant1")
+			dst, _ := client.Device("wg-tenant2")
+			if holders := len(src.Peers) + len(dst.Peers); holders != 1 {
+				t.Fatalf("peer is held by %d devices (err: %v)", holders, err)
+			}
+			if done := len(dst.Peers) == 1; done != (err == nil) {
+				t.Errorf("move outcome does not match its error: moved %t, err %v", done, err)
+			}
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected deadline exceeded, got %v", err)
+			}
+			if inventoryMoved := len(cfg.Devices["wg-tenant2"].Peers) == 1; inventoryMoved != (err == nil) {
+				t.Errorf("inventory does not match the outcome of the move")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package wgconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ParseNetDev parses systemd netdev configuration and returns the set of
+// WireGuard peers that it contains. It is the inverse of PeerList.NetDev.
+//
+// Comments that immediately precede a [WireGuardPeer] section are used to
+// populate the name, description and labels of the peer. Peer sections that
+// have been commented out because they lack a public key or allowed IP
+// addresses are also returned, and are marked as disabled if they hold both.
+// Sections other than [WireGuardPeer] are ignored. Use the Enabled filter
+// to select the peers that systemd would configure.
+//
+// Peer comments are unescaped, reversing the encoding applied by NetDev.
+// A peer comment holding only a parenthetical is treated as the peer's
+// description. When a peer comment lacks a parenthetical description, its
+// contents are treated as the peer's name.
+func ParseNetDev(r io.Reader) (PeerList, error) {
+	var (
+		list     PeerList
+		current  *Peer
+		disabled bool
+		comments []string
+		number   int
+	)
+
+	flush := func() {
+		if current != nil {
+			// Commented out sections that are otherwise complete have
+			// been disabled deliberately
+			current.Disabled = disabled && current.PublicKey != zeroKey && len(current.AllowedIPs) > 0
+			list = append(list, *current)
+			current = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Blank lines separate peer comments from anything before them
+		if line == "" {
+			comments = nil
+			continue
+		}
+
+		// Determine whether the line has been commented out
+		commented := strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+		content := line
+		if commented {
+			content = strings.TrimSpace(line[1:])
+		}
+
+		// Section headers
+		if strings.HasPrefix(content, "[") && strings.HasSuffix(content, "]") {
+			if commented && content != "[WireGuardPeer]" {
+				comments = append(comments, line)
+				continue
+			}
+			flush()
+			if content == "[WireGuardPeer]" {
+				current = &Peer{}
+				disabled = commented
+				applyPeerComments(current, comments)
+			}
+			comments = nil
+			continue
+		}
+
+		// Comments that aren't part of a disabled peer
+		if commented && (current == nil || !disabled || !isPeerKey(content)) {
+			comments = append(comments, line)
+			continue
+		}
+
+		// Key and value pairs outside of a peer section are ignored
+		if current == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(content, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: invalid entry: %q", number, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "PublicKey":
+			if value == "" {
+				continue
+			}
+			k, err := wgtypes.ParseKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid public key: %v", number, err)
+			}
+			current.PublicKey = k
+		case "AllowedIPs":
+			ipnets, err := parseAllowedIPs(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", number, err)
+			}
+			current.AllowedIPs = append(current.AllowedIPs, ipnets...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return list, nil
+}
+
+// isPeerKey returns true if content holds a key that is recognized within
+// a commented out [WireGuardPeer] section.
+func isPeerKey(content string) bool {
+	return strings.HasPrefix(content, "PublicKey=") || strings.HasPrefix(content, "AllowedIPs=")
+}
+
+// applyPeerComments populates the name, description and labels of p from
+// the comments that precede its section.
+func applyPeerComments(p *Peer, comments []string) {
+	var heading string
+	for _, comment := range comments {
+		// Managed block markers are never peer comments
+		if trimmed := strings.TrimSpace(comment); trimmed == ManagedBegin || trimmed == ManagedEnd {
+			continue
+		}
+		if strings.HasPrefix(comment, labelPrefix) {
+			key, value, found := strings.Cut(strings.TrimPrefix(comment, labelPrefix), "=")
+			if found && key != "" {
+				if p.Labels == nil {
+					p.Labels = make(Labels)
+				}
+				p.Labels[unescapeComment(key)] = unescapeComment(value)
+				continue
+			}
+		}
+		heading = strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	}
+
+	if heading == "" {
+		return
+	}
+	if strings.HasPrefix(heading, "(") && strings.HasSuffix(heading, ")") {
+		p.Description = unescapeComment(heading[1 : len(heading)-1])
+	} else if name, description, found := strings.Cut(heading, " ("); found && strings.HasSuffix(description, ")") {
+		p.Name = unescapeComment(name)
+		p.Description = unescapeComment(strings.TrimSuffix(description, ")"))
+	} else {
+		p.Name = unescapeComment(heading)
+	}
+}
+
+// parseAllowedIPs parses a list of IP networks separated by commas or
+// whitespace.
+func parseAllowedIPs(value string) (AllowedIPs, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	var ipnets AllowedIPs
+	for _, field := range fields {
+		ip, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP address: %v", err)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		ipnets = append(ipnets, net.IPNet{IP: ip, Mask: network.Mask})
+	}
+	return ipnets, nil
+}
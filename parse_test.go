@@ -0,0 +1,93 @@
+package wgconf_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestParseNetDevRoundTrip(t *testing.T) {
+	var peers wgconf.PeerList
+	for _, tt := range tests {
+		if tt.NetDev == "" || tt.Name == "Filtered2" {
+			continue
+		}
+		peers = append(peers, tt.Peer)
+	}
+	peers = append(peers, wgconf.Peer{
+		Name:        "L1",
+		Description: "labeled",
+		Labels:      wgconf.Labels{"owner": "alice", "ticket": "OPS-1234", "expires": "2030-01-01"},
+		PublicKey:   mustParseKey(public2),
+		AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.1.1/32")},
+	}, wgconf.Peer{
+		Name:       "[WireGuardPeer]",
+		PublicKey:  mustParseKey(public4),
+		AllowedIPs: []net.IPNet{mustParseIPNet("10.0.1.3/32")},
+	}, wgconf.Peer{
+		Description: "alice@example.com",
+		PublicKey:   mustParseKey(public5),
+		AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.1.4/32")},
+	}, wgconf.Peer{
+		Name:       "D1",
+		PublicKey:  mustParseKey(public3),
+		AllowedIPs: []net.IPNet{mustParseIPNet("10.0.1.2/32")},
+		Disabled:   true,
+	})
+
+	parsed, err := wgconf.ParseNetDev(strings.NewReader(peers.NetDev()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(parsed.NetDev(), peers.NetDev()); diff != "" {
+		t.Fatalf("unexpected ParseNetDev() round trip output (-want +got):\n%s", diff)
+	}
+	if len(parsed) != len(peers) {
+		t.Fatalf("unexpected number of parsed peers: want %d, got %d", len(peers), len(parsed))
+	}
+	for i := range peers {
+		if wgconf.Compare(peers[i], parsed[i]) != 0 {
+			t.Errorf("peer %d (%s) did not survive a round trip", i, peers[i].Name)
+		}
+	}
+}
+
+func TestParseNetDevLabels(t *testing.T) {
+	const input = `[NetDev]
+Name=wg0
+Kind=wireguard
+
+# This comment is not associated with a peer
+
+# L1 (labeled)
+# Label: owner=alice
+# Label: team=ops
+[WireGuardPeer]
+PublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.1/32, 10.0.0.2/32
+
+# L2
+# Label: owner=bob
+[WireGuardPeer]
+PublicKey=bPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=
+AllowedIPs=10.0.0.3/32`
+
+	peers, err := wgconf.ParseNetDev(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(peers), "L1,L2"); diff != "" {
+		t.Fatalf("unexpected peers (-want +got):\n%s", diff)
+	}
+	if got := peers[0].AllowedIPs.String(); got != "10.0.0.1/32,10.0.0.2/32" {
+		t.Errorf("unexpected allowed IPs for L1: %s", got)
+	}
+	if diff := multilineDiff(testNames(peers.Match(wgconf.HasLabel("team"))), "L1"); diff != "" {
+		t.Errorf("unexpected peers for HasLabel filter (-want +got):\n%s", diff)
+	}
+	if diff := multilineDiff(testNames(peers.Match(wgconf.LabelEquals("owner", "bob"))), "L2"); diff != "" {
+		t.Errorf("unexpected peers for LabelEquals filter (-want +got):\n%s", diff)
+	}
+}
@@ -2,53 +2,98 @@ package wgconf
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
+// labelPrefix is the comment prefix used to record peer labels in netdev
+// configuration.
+const labelPrefix = "# Label: "
+
 // Key is a public or private key used by WireGuard.
 type Key = wgtypes.Key
 
 // PeerFilter is a filter that can be applied to peers.
 type PeerFilter func(Peer) bool
 
+// HasLabel returns a filter that matches peers with the given label key,
+// regardless of its value.
+func HasLabel(key string) PeerFilter {
+	return func(p Peer) bool {
+		_, ok := p.Labels[key]
+		return ok
+	}
+}
+
+// LabelEquals returns a filter that matches peers with the given label key
+// and value.
+func LabelEquals(key, value string) PeerFilter {
+	return func(p Peer) bool {
+		v, ok := p.Labels[key]
+		return ok && v == value
+	}
+}
+
+// Enabled is a filter that matches peers that can be configured on a
+// device. It excludes disabled peers and peers that lack a public key or
+// allowed IP addresses.
+func Enabled(p Peer) bool {
+	return !p.Disabled && p.PublicKey != zeroKey && len(p.AllowedIPs) > 0
+}
+
 // Peer is a WireGuard peer.
 type Peer struct {
 	Name        string
 	Description string
+	Labels      Labels
 	PublicKey   Key
 	AllowedIPs  AllowedIPs
+
+	// Disabled peers are written as commented out sections in netdev
+	// configuration and are ignored by systemd.
+	Disabled bool
+}
+
+// Labels hold arbitrary key and value pairs that are associated with a peer,
+// such as its owner or an expiration date. They are recorded as structured
+// comments in the netdev configuration.
+type Labels map[string]string
+
+// Keys returns the label keys in sorted order.
+func (labels Labels) Keys() []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // NetDev returns the systemd netdev configuration for the peer.
 func (p Peer) NetDev() string {
-	// Collect sanitized string representations of each field
-	name := sanitizeComment(p.Name)
-	description := sanitizeComment(p.Description)
+	// Collect escaped string representations of each field
+	comments := p.comments()
 	pubkey := sanitizeKey(p.PublicKey)
 	addrs := p.AllowedIPs.String()
 
 	// Reject keyless peers without a comment
-	if name == "" && description == "" && pubkey == "" {
+	if len(comments) == 0 && pubkey == "" {
 		return ""
 	}
 
 	// Aggregate the peer configuration with a string builder
 	var sb strings.Builder
 
-	// Include a leading comment with the peer name and/or description
-	switch {
-	case name != "" && description != "":
-		sb.WriteString(fmt.Sprintf("# %s (%s)\n", name, description))
-	case name != "":
-		sb.WriteString(fmt.Sprintf("# %s\n", name))
-	case description != "":
-		sb.WriteString(fmt.Sprintf("# %s\n", description))
+	// Include leading comments with the peer name, description and labels
+	for _, comment := range comments {
+		sb.WriteString(comment)
+		sb.WriteString("\n")
 	}
 
 	// Include the WireGuardPeer entry
-	if pubkey == "" || addrs == "" {
+	if p.Disabled || pubkey == "" || addrs == "" {
 		sb.WriteString("#[WireGuardPeer]\n")
 		sb.WriteString(fmt.Sprintf("#PublicKey=%s\n", pubkey))
 		sb.WriteString(fmt.Sprintf("#AllowedIPs=%s", addrs))
@@ -60,3 +105,31 @@ func (p Peer) NetDev() string {
 
 	return sb.String()
 }
+
+// comments returns the comment lines that precede the peer's section in
+// netdev configuration, without line terminators.
+func (p Peer) comments() []string {
+	var comments []string
+
+	// Include a leading comment with the peer name and/or description
+	name := escapeComment(p.Name)
+	description := escapeComment(p.Description)
+	switch {
+	case name != "" && description != "":
+		comments = append(comments, fmt.Sprintf("# %s (%s)", name, description))
+	case name != "":
+		comments = append(comments, fmt.Sprintf("# %s", name))
+	case description != "":
+		comments = append(comments, fmt.Sprintf("# (%s)", description))
+	}
+
+	// Include a comment for each label
+	for _, key := range p.Labels.Keys() {
+		if key == "" {
+			continue
+		}
+		comments = append(comments, fmt.Sprintf("%s%s=%s", labelPrefix, escapeComment(key), escapeComment(p.Labels[key])))
+	}
+
+	return comments
+}
@@ -87,7 +87,7 @@ var tests = []PeerTest{
 			PublicKey:   mustParseKey(public1),
 			AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.0.2/32")},
 		},
-		NetDev: "# F1 (test-filtered-one)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.2/32",
+		NetDev: "# F1!$%25*!@#$%28%29@!#$^ (test -filtered#@^#@&^ %0A%0A-one)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.2/32",
 	},
 	{
 		Name: "Filtered2",
@@ -97,7 +97,28 @@ var tests = []PeerTest{
 			PublicKey:   mustParseKey(public1),
 			AllowedIPs:  []net.IPNet{{}, {IP: net.IPv4(0, 0, 0, 0)}, mustParseIPNet("10.0.0.20/32"), {IP: net.IP{0}}},
 		},
-		NetDev: "# F2 (test-filtered-two)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.20/32",
+		NetDev: "# F2 (test-/filtered/-two)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.20/32",
+	},
+	{
+		Name: "Escaped1",
+		Peer: wgconf.Peer{
+			Name:        "Alice Smith's laptop",
+			Description: "alice_smith@example.com",
+			PublicKey:   mustParseKey(public1),
+			AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.0.3/32")},
+		},
+		NetDev: "# Alice Smith's laptop (alice_smith@example.com)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.3/32",
+	},
+	{
+		Name: "Escaped2",
+		Peer: wgconf.Peer{
+			Name:        " Zoë (ops) ",
+			Description: "line one\r\n[NetDev]\nName=evil",
+			Labels:      wgconf.Labels{"ticket": "OPS=1\n[WireGuardPeer]"},
+			PublicKey:   mustParseKey(public1),
+			AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.0.4/32")},
+		},
+		NetDev: "# %20Zoë %28ops%29%20 (line one%0D%0A%5BNetDev%5D%0AName%3Devil)\n# Label: ticket=OPS%3D1%0A%5BWireGuardPeer%5D\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.4/32",
 	},
 	{
 		Name: "MissingName",
@@ -106,7 +127,7 @@ var tests = []PeerTest{
 			PublicKey:   mustParseKey(public1),
 			AllowedIPs:  []net.IPNet{mustParseIPNet("10.0.0.22/32")},
 		},
-		NetDev: "# M1\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.22/32",
+		NetDev: "# (M1)\n[WireGuardPeer]\nPublicKey=aPxGwq8zERHQ3Q1cOZFdJ+cvJX5Ka4mLN38AyYKYF10=\nAllowedIPs=10.0.0.22/32",
 	},
 	{
 		Name: "MissingDescription",
@@ -44,3 +44,15 @@ func (list PeerList) Match(filter PeerFilter) PeerList {
 	}
 	return filtered
 }
+
+// Exclude returns the set of peers that are not present in other. Peers are
+// identified by their public key.
+func (list PeerList) Exclude(other PeerList) PeerList {
+	excluded := make(map[Key]bool, len(other))
+	for _, peer := range other {
+		excluded[peer.PublicKey] = true
+	}
+	return list.Match(func(p Peer) bool {
+		return !excluded[p.PublicKey]
+	})
+}
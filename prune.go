@@ -0,0 +1,128 @@
+package wgconf
+
+import "time"
+
+// Activity describes how recently a peer has completed a handshake.
+type Activity int
+
+// Peer activity levels.
+const (
+	// Active peers have completed a handshake recently.
+	Active Activity = iota
+
+	// Idle peers have not completed a handshake for a while, but have not
+	// yet been idle long enough to be considered stale.
+	Idle
+
+	// Stale peers have been idle for longer than the stale threshold, or
+	// have never completed a handshake and are not within a grace period.
+	Stale
+)
+
+// String returns a string representation of the activity level.
+func (a Activity) String() string {
+	switch a {
+	case Active:
+		return "active"
+	case Idle:
+		return "idle"
+	case Stale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// Default thresholds for prune policies.
+const (
+	DefaultPruneIdleAfter = time.Hour
+	DefaultStaleAfter     = 30 * 24 * time.Hour
+	DefaultGracePeriod    = 24 * time.Hour
+)
+
+// PrunePolicy classifies peers by their handshake activity and selects
+// stale peers as candidates for removal.
+type PrunePolicy struct {
+	// IdleAfter is the amount of time since the last handshake after which
+	// a peer is considered idle. If zero, DefaultPruneIdleAfter is used.
+	IdleAfter time.Duration
+
+	// StaleAfter is the amount of time since the last handshake after which
+	// a peer is considered stale. If zero, DefaultStaleAfter is used.
+	StaleAfter time.Duration
+
+	// GracePeriod is the amount of time a peer that has never completed a
+	// handshake is given to connect after it was provisioned. If zero,
+	// DefaultGracePeriod is used.
+	GracePeriod time.Duration
+
+	// Provisioned, if non-nil, returns the time at which a peer was added,
+	// or the zero time if it is unknown. Peers that have never completed a
+	// handshake are given a grace period after they were provisioned
+	// before they are considered stale. Peers with an unknown provisioning
+	// time have no grace period, so Provisioned should be supplied when
+	// peers are pruned shortly after being added.
+	Provisioned func(Peer) time.Time
+
+	// Exempt, if non-nil, matches peers that are never pruned, such as
+	// infrastructure peers. Exempt peers are still classified.
+	Exempt PeerFilter
+}
+
+// Classify returns the activity level of a peer at the given time.
+//
+// Peers that have never completed a handshake are stale, unless they were
+// provisioned within the grace period, in which case they are idle.
+func (policy PrunePolicy) Classify(status PeerStatus, now time.Time) Activity {
+	idleAfter, staleAfter, gracePeriod := policy.thresholds()
+	if !status.HasHandshake() {
+		var provisioned time.Time
+		if policy.Provisioned != nil {
+			provisioned = policy.Provisioned(status.Peer)
+		}
+		if !provisioned.IsZero() && now.Sub(provisioned) <= gracePeriod {
+			return Idle
+		}
+		return Stale
+	}
+	elapsed := now.Sub(status.LastHandshake)
+	switch {
+	case elapsed > staleAfter:
+		return Stale
+	case elapsed > idleAfter:
+		return Idle
+	default:
+		return Active
+	}
+}
+
+// thresholds returns the thresholds of the policy with defaults applied.
+func (policy PrunePolicy) thresholds() (idleAfter, staleAfter, gracePeriod time.Duration) {
+	idleAfter, staleAfter, gracePeriod = policy.IdleAfter, policy.StaleAfter, policy.GracePeriod
+	if idleAfter <= 0 {
+		idleAfter = DefaultPruneIdleAfter
+	}
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	return idleAfter, staleAfter, gracePeriod
+}
+
+// Candidates returns the set of stale peers that are not exempt from
+// pruning. The returned peers can be removed from an inventory with
+// PeerList.Exclude before it is reconciled.
+func (policy PrunePolicy) Candidates(statuses PeerStatusList, now time.Time) PeerList {
+	var candidates PeerList
+	for _, status := range statuses {
+		if policy.Exempt != nil && policy.Exempt(status.Peer) {
+			continue
+		}
+		if policy.Classify(status, now) == Stale {
+			candidates = append(candidates, status.Peer)
+		}
+	}
+	return candidates
+}
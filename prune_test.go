@@ -0,0 +1,77 @@
+package wgconf_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestPrunePolicy(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := wgconf.PrunePolicy{
+		IdleAfter:  time.Hour,
+		StaleAfter: 30 * 24 * time.Hour,
+		Exempt:     wgconf.LabelEquals("role", "infrastructure"),
+		Provisioned: func(p wgconf.Peer) time.Time {
+			switch p.Name {
+			case "P4":
+				return now.Add(-48 * time.Hour)
+			case "P6":
+				return now.Add(-time.Hour)
+			}
+			return time.Time{}
+		},
+	}
+
+	statuses := wgconf.PeerStatusList{
+		{Peer: wgconf.Peer{Name: "P1", PublicKey: mustParseKey(public1)}, LastHandshake: now.Add(-time.Minute)},
+		{Peer: wgconf.Peer{Name: "P2", PublicKey: mustParseKey(public2)}, LastHandshake: now.Add(-2 * time.Hour)},
+		{Peer: wgconf.Peer{Name: "P3", PublicKey: mustParseKey(public3)}, LastHandshake: now.Add(-60 * 24 * time.Hour)},
+		{Peer: wgconf.Peer{Name: "P4", PublicKey: mustParseKey(public4)}},
+		{Peer: wgconf.Peer{Name: "P5", PublicKey: mustParseKey(public5), Labels: wgconf.Labels{"role": "infrastructure"}}},
+		{Peer: wgconf.Peer{Name: "P6", PublicKey: mustParseKey(public6)}},
+		{Peer: wgconf.Peer{Name: "P7", PublicKey: mustParseKey(public7)}},
+	}
+
+	var activity []string
+	for _, status := range statuses {
+		activity = append(activity, policy.Classify(status, now).String())
+	}
+	if diff := multilineDiff(strings.Join(activity, ","), "active,idle,stale,stale,stale,idle,stale"); diff != "" {
+		t.Errorf("unexpected classification (-want +got):\n%s", diff)
+	}
+
+	candidates := policy.Candidates(statuses, now)
+	if diff := multilineDiff(testNames(candidates), "P3,P4,P7"); diff != "" {
+		t.Fatalf("unexpected prune candidates (-want +got):\n%s", diff)
+	}
+
+	remaining := statuses.Peers().Exclude(candidates)
+	if diff := multilineDiff(testNames(remaining), "P1,P2,P5,P6"); diff != "" {
+		t.Fatalf("unexpected remaining peers (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrunePolicyDefaults(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	var policy wgconf.PrunePolicy
+
+	for _, tt := range []struct {
+		ago  time.Duration
+		want wgconf.Activity
+	}{
+		{time.Second, wgconf.Active},
+		{2 * time.Hour, wgconf.Idle},
+		{wgconf.DefaultStaleAfter + time.Hour, wgconf.Stale},
+	} {
+		status := wgconf.PeerStatus{LastHandshake: now.Add(-tt.ago)}
+		if got := policy.Classify(status, now); got != tt.want {
+			t.Errorf("handshake %s ago: want %s, got %s", tt.ago, tt.want, got)
+		}
+	}
+	if got := policy.Classify(wgconf.PeerStatus{}, now); got != wgconf.Stale {
+		t.Errorf("peer without a handshake: want %s, got %s", wgconf.Stale, got)
+	}
+}
@@ -1,7 +1,11 @@
 package wgconf
 
 import (
-	"golang.zx2c4.com/wireguard/wgctrl"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -11,20 +15,288 @@ import (
 // The difference between the old peer list and the new peer list is used to
 // determine the set of peer list changes that should be issued. Peers present
 // in the old list but not present in the new list will be removed. Peers
-// that are not present in either list will not be modified.
-func ReconcilePeers(client *wgctrl.Client, device string, oldPeers, newPeers PeerList) error {
+// that are not present in either list will not be modified. Peers in the new
+// list that do not match the Enabled filter are treated as absent, so they
+// are never configured and are removed if present in the old list.
+func ReconcilePeers(client Client, device string, oldPeers, newPeers PeerList) error {
+	return ReconcilePeersContext(context.Background(), client, device, oldPeers, newPeers)
+}
+
+// ReconcilePeersContext updates the peer list configuration for the given
+// WireGuard device in the same way as ReconcilePeers. It returns early if
+// ctx is cancelled or its deadline is exceeded.
+func ReconcilePeersContext(ctx context.Context, client Client, device string, oldPeers, newPeers PeerList) error {
+	_, err := ReconcileContext(ctx, client, device, oldPeers, newPeers, ReconcileOptions{})
+	return err
+}
+
+// ReconcileOptions control the behavior of Reconcile.
+type ReconcileOptions struct {
+	// Snapshot causes a snapshot of the device to be captured before any
+	// changes are applied. It can be used to undo the changes with
+	// Rollback.
+	Snapshot bool
+
+	// BatchSize is the maximum number of peer changes issued in a single
+	// device configuration call. If zero, all changes are issued at once.
+	BatchSize int
+
+	// ContinueOnError causes the remaining batches to be issued after a
+	// batch fails. By default reconciliation stops at the first failure.
+	ContinueOnError bool
+
+	// Verify causes the device to be collected again after the changes
+	// have been applied, and compared with the new peers. Any residual
+	// drift is reported as a *DriftError.
+	Verify bool
+
+	// VerifyRetries is the number of times the changes needed to correct
+	// drift are issued again before a *DriftError is returned. It is only
+	// used when Verify is true.
+	VerifyRetries int
+
+	// VerifyDelay is the amount of time to wait before each retry.
+	VerifyDelay time.Duration
+}
+
+// ReconcileResult describes the outcome of Reconcile.
+type ReconcileResult struct {
+	// Added, Updated and Removed are the peer changes that were determined
+	// to be necessary.
+	Added, Updated, Removed PeerList
+
+	// Snapshot is the state of the device before changes were applied. It
+	// is only captured when requested.
+	Snapshot *Snapshot
+
+	// Batches holds the outcome of each batch of changes that was issued.
+	Batches []BatchResult
+
+	// Interface holds the interface settings that were changed. It is
+	// only populated when a configuration is reconciled.
+	Interface Interface
+}
+
+// BatchResult describes the outcome of a single batch of peer changes.
+type BatchResult struct {
+	// Index is the position of the batch, starting at zero.
+	Index int
+
+	// Removed, Updated and Added are the peer changes within the batch.
+	Removed, Updated, Added PeerList
+
+	// Err is the error returned by the device, if any.
+	Err error
+}
+
+// Peers returns all of the peers changed by the batch.
+func (b BatchResult) Peers() PeerList {
+	peers := make(PeerList, 0, len(b.Removed)+len(b.Updated)+len(b.Added))
+	peers = append(peers, b.Removed...)
+	peers = append(peers, b.Updated...)
+	return append(peers, b.Added...)
+}
+
+// Reconcile updates the peer list configuration for the given WireGuard
+// device in the same way as ReconcilePeers, with additional options.
+//
+// Removals are issued before updates, and updates before additions, so
+// that allowed IP addresses can move from one peer to another. When
+// batching is enabled each batch is issued as a separate device
+// configuration call. If any batch fails a *ReconcileError is returned that
+// identifies the peers that could not be configured.
+//
+// When a snapshot is requested it is returned even if applying the changes
+// fails, so that a partially applied configuration can be rolled back.
+func Reconcile(client Client, device string, oldPeers, newPeers PeerList, opts ReconcileOptions) (ReconcileResult, error) {
+	return ReconcileContext(context.Background(), client, device, oldPeers, newPeers, opts)
+}
+
+// ReconcileContext updates the peer list configuration for the given
+// WireGuard device in the same way as Reconcile.
+//
+// The context is checked before each batch is issued and while waiting
+// between verification retries. If ctx is cancelled or its deadline is
+// exceeded the remaining changes are abandoned and an error wrapping the
+// context's error is returned. Batches that have already been issued are
+// not undone.
+func ReconcileContext(ctx context.Context, client Client, device string, oldPeers, newPeers PeerList, opts ReconcileOptions) (ReconcileResult, error) {
+	var result ReconcileResult
+
+	// Capture the state of the device before making any changes
+	if opts.Snapshot {
+		snapshot, err := TakeSnapshotContext(ctx, client, device)
+		if err != nil {
+			return result, fmt.Errorf("failed to capture snapshot of WireGuard device %s: %w", device, err)
+		}
+		result.Snapshot = &snapshot
+	}
+
+	// Peers that systemd would ignore are not configured
+	newPeers = newPeers.Match(Enabled)
+
 	// Compare the peers to determine what changes are necessary
-	added, updated, removed, _ := CompareLists(oldPeers, newPeers)
+	result.Added, result.Updated, result.Removed, _ = CompareLists(oldPeers, newPeers)
+
+	// Issue the configuration changes in batches
+	var err error
+	result.Batches, err = applyChanges(ctx, client, device, result.Removed, result.Updated, result.Added, opts, 0)
+	if err != nil || !opts.Verify {
+		return result, err
+	}
+
+	// Verify that the device matches the new peers, retrying if necessary
+	for attempt := 0; ; attempt++ {
+		current, err := CollectPeersContext(ctx, client, device)
+		if err != nil {
+			return result, fmt.Errorf("failed to verify WireGuard device %s: %w", device, err)
+		}
+		drift := checkDrift(device, current, oldPeers, newPeers)
+		if drift == nil {
+			return result, nil
+		}
+		if attempt >= opts.VerifyRetries {
+			return result, drift
+		}
+		if err := sleep(ctx, opts.VerifyDelay); err != nil {
+			return result, contextError(device, err)
+		}
+
+		// Issue the changes needed to correct the drift
+		var updated PeerList
+		for _, mismatch := range drift.Mismatched {
+			updated = append(updated, mismatch.Desired)
+		}
+		batches, err := applyChanges(ctx, client, device, drift.Lingering, updated, drift.Missing, opts, len(result.Batches))
+		result.Batches = append(result.Batches, batches...)
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+// applyChanges issues peer changes to a device in batches. Batch indices
+// start at offset. No further batches are issued once ctx is done.
+func applyChanges(ctx context.Context, client Client, device string, removed, updated, added PeerList, opts ReconcileOptions, offset int) (batches []BatchResult, err error) {
+	var failed []BatchResult
+	for _, batch := range makeBatches(removed, updated, added, opts.BatchSize) {
+		if err := ctx.Err(); err != nil {
+			if len(failed) > 0 {
+				return batches, &ReconcileError{Device: device, Failed: failed, Err: contextError(device, err)}
+			}
+			return batches, contextError(device, err)
+		}
+		batch.Index += offset
+		batch.Err = configureContext(ctx, client, device, wgtypes.Config{
+			Peers: peerConfigs(batch.Added, batch.Updated, batch.Removed),
+		})
+		batches = append(batches, batch)
+		if batch.Err != nil {
+			failed = append(failed, batch)
+			if !opts.ContinueOnError {
+				break
+			}
+		}
+	}
 
-	// Build a list of peer changes
+	if len(failed) > 0 {
+		return batches, &ReconcileError{Device: device, Failed: failed}
+	}
+	return batches, nil
+}
+
+// makeBatches divides peer changes into batches of at most size changes,
+// preserving the order of removals, updates and additions. If size is zero
+// or negative a single batch is returned.
+func makeBatches(removed, updated, added PeerList, size int) []BatchResult {
+	total := len(removed) + len(updated) + len(added)
+	if size <= 0 || size > total {
+		size = total
+	}
+
+	var batches []BatchResult
+	for total > 0 {
+		batch := BatchResult{Index: len(batches)}
+		n := size
+		take := func(list *PeerList) PeerList {
+			count := n
+			if count > len(*list) {
+				count = len(*list)
+			}
+			taken := (*list)[:count]
+			*list = (*list)[count:]
+			n -= count
+			return taken
+		}
+		batch.Removed = take(&removed)
+		batch.Updated = take(&updated)
+		batch.Added = take(&added)
+		total -= size - n
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// ReconcileError is returned when one or more batches of peer changes could
+// not be applied to a device.
+type ReconcileError struct {
+	Device string
+	Failed []BatchResult
+
+	// Err is the reason the remaining batches were abandoned, such as a
+	// cancelled context. It is nil if every batch was attempted.
+	Err error
+}
+
+// Peers returns the peers in all of the failed batches.
+func (e *ReconcileError) Peers() PeerList {
+	var peers PeerList
+	for _, batch := range e.Failed {
+		peers = append(peers, batch.Peers()...)
+	}
+	return peers
+}
+
+// Error returns a string representation of the error.
+func (e *ReconcileError) Error() string {
+	var failures []string
+	for _, batch := range e.Failed {
+		var titles []string
+		for _, peer := range batch.Peers() {
+			titles = append(titles, peerTitle(peer))
+		}
+		failures = append(failures, fmt.Sprintf("batch %d (%s): %v", batch.Index, strings.Join(titles, ", "), batch.Err))
+	}
+	msg := fmt.Sprintf("failed to configure peers for WireGuard device %s: %s", e.Device, strings.Join(failures, "; "))
+	if e.Err != nil {
+		msg += fmt.Sprintf("; remaining batches abandoned: %v", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the reason the remaining batches were abandoned, if any,
+// and otherwise the error of the first failed batch.
+func (e *ReconcileError) Unwrap() error {
+	if e.Err != nil {
+		return e.Err
+	}
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e.Failed[0].Err
+}
+
+// peerConfigs builds a list of peer changes for a device. Removals are
+// ordered before updates, and updates before additions, so that allowed IP
+// addresses can move between peers.
+func peerConfigs(added, updated, removed PeerList) []wgtypes.PeerConfig {
 	var peers []wgtypes.PeerConfig
 
-	// Additions
-	for _, peer := range added {
+	// Removals
+	for _, peer := range removed {
 		peers = append(peers, wgtypes.PeerConfig{
-			PublicKey:         peer.PublicKey,
-			AllowedIPs:        peer.AllowedIPs,
-			ReplaceAllowedIPs: true,
+			PublicKey: peer.PublicKey,
+			Remove:    true,
 		})
 	}
 
@@ -38,16 +310,14 @@ func ReconcilePeers(client *wgctrl.Client, device string, oldPeers, newPeers Pee
 		})
 	}
 
-	// Removals
-	for _, peer := range removed {
+	// Additions
+	for _, peer := range added {
 		peers = append(peers, wgtypes.PeerConfig{
-			PublicKey: peer.PublicKey,
-			Remove:    true,
+			PublicKey:         peer.PublicKey,
+			AllowedIPs:        peer.AllowedIPs,
+			ReplaceAllowedIPs: true,
 		})
 	}
 
-	// Issue the configuration change
-	return client.ConfigureDevice(device, wgtypes.Config{
-		Peers: peers,
-	})
+	return peers
 }
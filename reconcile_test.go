@@ -0,0 +1,98 @@
+package wgconf_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestReconcileBatches(t *testing.T) {
+	newClient := func() *fakeClient {
+		return newFakeClient(wgtypes.Device{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+				{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+				{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32")}},
+			},
+		})
+	}
+
+	oldPeers, err := wgconf.CollectPeers(newClient(), "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move 10.0.0.1/32 from a removed peer to an added peer
+	newPeers := wgconf.PeerList{
+		{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.33/32")}},
+		{PublicKey: mustParseKey(public4), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+		{PublicKey: mustParseKey(public5), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.5/32")}},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		client := newClient()
+		result, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{BatchSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Batches) != 3 || len(client.calls) != 3 {
+			t.Fatalf("unexpected number of batches: %d results, %d calls", len(result.Batches), len(client.calls))
+		}
+
+		// Removals must precede updates, which must precede additions
+		var order []string
+		for _, call := range client.calls {
+			for _, pc := range call.Peers {
+				switch {
+				case pc.Remove:
+					order = append(order, "remove")
+				case pc.UpdateOnly:
+					order = append(order, "update")
+				default:
+					order = append(order, "add")
+				}
+			}
+		}
+		if diff := multilineDiff(strings.Join(order, ","), "remove,remove,update,add,add"); diff != "" {
+			t.Fatalf("unexpected order of changes (-want +got):\n%s", diff)
+		}
+
+		current, err := wgconf.CollectPeers(client, "wg0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added, updated, removed, _ := wgconf.CompareLists(current, newPeers); len(added)+len(updated)+len(removed) != 0 {
+			t.Fatalf("device does not match the desired peers:\n%s", current.NetDev())
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		client := newClient()
+		failure := errors.New("netlink: message too long")
+		client.configErr = func(name string, cfg wgtypes.Config) error {
+			for _, pc := range cfg.Peers {
+				if pc.PublicKey == mustParseKey(public4) {
+					return failure
+				}
+			}
+			return nil
+		}
+
+		result, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{BatchSize: 2, ContinueOnError: true})
+		var rerr *wgconf.ReconcileError
+		if !errors.As(err, &rerr) || !errors.Is(err, failure) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Batches) != 3 || len(rerr.Failed) != 1 || rerr.Failed[0].Index != 1 {
+			t.Fatalf("unexpected batch results: %+v", result.Batches)
+		}
+		if !strings.Contains(err.Error(), public4) || !strings.Contains(err.Error(), public3) {
+			t.Fatalf("error does not identify the failed peers: %v", err)
+		}
+	})
+}
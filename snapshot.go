@@ -0,0 +1,202 @@
+package wgconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Snapshot is a complete record of the configuration of a WireGuard device
+// at a point in time, including its interface settings and the full
+// configuration of each peer. It can be restored with Rollback.
+//
+// Snapshots include the private key of the device and the preshared keys
+// of its peers, and must be stored accordingly.
+type Snapshot struct {
+	Device    string         `json:"device"`
+	Time      time.Time      `json:"time"`
+	Interface Interface      `json:"interface"`
+	Peers     []SnapshotPeer `json:"peers"`
+}
+
+// SnapshotPeer is the configuration of a peer within a snapshot.
+type SnapshotPeer struct {
+	PublicKey                   Key
+	PresharedKey                Key
+	Endpoint                    *net.UDPAddr
+	PersistentKeepaliveInterval time.Duration
+	AllowedIPs                  AllowedIPs
+}
+
+// jsonSnapshotPeer is the JSON representation of a snapshot peer.
+type jsonSnapshotPeer struct {
+	PublicKey                   string     `json:"public_key"`
+	PresharedKey                string     `json:"preshared_key,omitempty"`
+	Endpoint                    string     `json:"endpoint,omitempty"`
+	PersistentKeepaliveInterval string     `json:"persistent_keepalive_interval,omitempty"`
+	AllowedIPs                  AllowedIPs `json:"allowed_ips"`
+}
+
+// MarshalJSON returns a JSON representation of the peer.
+func (p SnapshotPeer) MarshalJSON() ([]byte, error) {
+	v := jsonSnapshotPeer{
+		PublicKey:    p.PublicKey.String(),
+		PresharedKey: sanitizeKey(p.PresharedKey),
+		AllowedIPs:   p.AllowedIPs,
+	}
+	if p.Endpoint != nil {
+		v.Endpoint = p.Endpoint.String()
+	}
+	if p.PersistentKeepaliveInterval != 0 {
+		v.PersistentKeepaliveInterval = p.PersistentKeepaliveInterval.String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON parses a JSON representation of the peer.
+func (p *SnapshotPeer) UnmarshalJSON(data []byte) error {
+	var v jsonSnapshotPeer
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var (
+		out SnapshotPeer
+		err error
+	)
+	if out.PublicKey, err = wgtypes.ParseKey(v.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if v.PresharedKey != "" {
+		if out.PresharedKey, err = wgtypes.ParseKey(v.PresharedKey); err != nil {
+			return fmt.Errorf("invalid preshared key: %v", err)
+		}
+	}
+	if v.Endpoint != "" {
+		if out.Endpoint, err = net.ResolveUDPAddr("udp", v.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint: %v", err)
+		}
+	}
+	if v.PersistentKeepaliveInterval != "" {
+		if out.PersistentKeepaliveInterval, err = time.ParseDuration(v.PersistentKeepaliveInterval); err != nil {
+			return fmt.Errorf("invalid persistent keepalive interval: %v", err)
+		}
+	}
+	out.AllowedIPs = v.AllowedIPs
+	*p = out
+	return nil
+}
+
+// PeerList returns the peers of the snapshot.
+func (s Snapshot) PeerList() PeerList {
+	peers := make(PeerList, 0, len(s.Peers))
+	for _, peer := range s.Peers {
+		peers = append(peers, Peer{PublicKey: peer.PublicKey, AllowedIPs: peer.AllowedIPs})
+	}
+	return peers
+}
+
+// TakeSnapshot captures the current configuration of a device.
+func TakeSnapshot(client Client, device string) (Snapshot, error) {
+	return TakeSnapshotContext(context.Background(), client, device)
+}
+
+// TakeSnapshotContext captures the current configuration of a device. It
+// returns early if ctx is cancelled or its deadline is exceeded.
+func TakeSnapshotContext(ctx context.Context, client Client, device string) (Snapshot, error) {
+	dev, err := deviceContext(ctx, client, device)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return newSnapshot(dev), nil
+}
+
+func newSnapshot(dev *wgtypes.Device) Snapshot {
+	snapshot := Snapshot{
+		Device:    dev.Name,
+		Time:      time.Now(),
+		Interface: newInterface(dev),
+		Peers:     make([]SnapshotPeer, 0, len(dev.Peers)),
+	}
+	for _, peer := range dev.Peers {
+		snapshot.Peers = append(snapshot.Peers, SnapshotPeer{
+			PublicKey:                   peer.PublicKey,
+			PresharedKey:                peer.PresharedKey,
+			Endpoint:                    peer.Endpoint,
+			PersistentKeepaliveInterval: peer.PersistentKeepaliveInterval,
+			AllowedIPs:                  peer.AllowedIPs,
+		})
+	}
+	return snapshot
+}
+
+// Rollback restores a device to the configuration captured in a snapshot.
+// The peers of the device are replaced with exactly the peers in the
+// snapshot, and its interface settings are restored.
+func Rollback(client Client, snapshot Snapshot) error {
+	return RollbackContext(context.Background(), client, snapshot)
+}
+
+// RollbackContext restores a device to the configuration captured in a
+// snapshot in the same way as Rollback. It returns early if ctx is cancelled
+// or its deadline is exceeded.
+func RollbackContext(ctx context.Context, client Client, snapshot Snapshot) error {
+	return configureContext(ctx, client, snapshot.Device, snapshot.config())
+}
+
+// config returns the device configuration that restores the snapshot.
+func (s Snapshot) config() wgtypes.Config {
+	cfg := s.Interface.config()
+	cfg.ReplacePeers = true
+	cfg.Peers = make([]wgtypes.PeerConfig, 0, len(s.Peers))
+	for _, peer := range s.Peers {
+		presharedKey := peer.PresharedKey
+		keepalive := peer.PersistentKeepaliveInterval
+		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+			PublicKey:                   peer.PublicKey,
+			PresharedKey:                &presharedKey,
+			Endpoint:                    peer.Endpoint,
+			PersistentKeepaliveInterval: &keepalive,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  peer.AllowedIPs,
+		})
+	}
+	return cfg
+}
+
+// LoadSnapshot reads a snapshot from the file at path.
+func LoadSnapshot(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// Save atomically writes the snapshot to the file at path. The file is only
+// readable by its owner, because the snapshot holds private keys. If the
+// file already exists its mode is restricted before it is replaced.
+func (s Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// WriteFile preserves the mode of existing files, so restrict it first
+	if err := os.Chmod(path, 0600); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	_, err = WriteFile(path, data, WriteOptions{Mode: 0600})
+	return err
+}
@@ -0,0 +1,92 @@
+package wgconf_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	privateKey := mustParseKey(public7)
+	original := wgtypes.Device{
+		Name:         "wg0",
+		PrivateKey:   privateKey,
+		PublicKey:    privateKey.PublicKey(),
+		ListenPort:   51820,
+		FirewallMark: 42,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   mustParseKey(public1),
+				PresharedKey:                mustParseKey(public6),
+				Endpoint:                    &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7).To4(), Port: 51820},
+				PersistentKeepaliveInterval: 25 * time.Second,
+				AllowedIPs:                  []net.IPNet{mustParseIPNet("10.0.0.1/32")},
+			},
+			{
+				PublicKey:  mustParseKey(public2),
+				AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")},
+			},
+		},
+	}
+	client := newFakeClient(original)
+
+	current, err := wgconf.CollectPeers(client, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := wgconf.PeerList{
+		{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+	}
+
+	result, err := wgconf.Reconcile(client, "wg0", current, desired, wgconf.ReconcileOptions{Snapshot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Snapshot == nil {
+		t.Fatal("reconcile did not capture a snapshot")
+	}
+	if len(result.Added) != 1 || len(result.Removed) != 2 {
+		t.Fatalf("unexpected reconcile result: %+v", result)
+	}
+
+	// Save and load the snapshot as if it had been stored on disk
+	// An existing file must not leave the private keys readable by others
+	path := filepath.Join(t.TempDir(), "wg0.snapshot.json")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Snapshot.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("unexpected snapshot file mode: %v", mode)
+		}
+	}
+	snapshot, err := wgconf.LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wgconf.Rollback(client, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := client.Device("wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := fmt.Sprintf("%+v", original), fmt.Sprintf("%+v", *restored); want != got {
+		t.Fatalf("device was not restored:\nwant %s\ngot  %s", want, got)
+	}
+}
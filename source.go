@@ -0,0 +1,42 @@
+package wgconf
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// PeerSource provides a desired set of peers.
+type PeerSource interface {
+	Peers() (PeerList, error)
+}
+
+// NetDevFile is a PeerSource that parses systemd netdev configuration from
+// the file at the given path.
+type NetDevFile string
+
+// Peers parses the file and returns its peers.
+func (path NetDevFile) Peers() (PeerList, error) {
+	f, err := os.Open(string(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseNetDev(f)
+}
+
+// JSONFile is a PeerSource that reads a JSON array of peers from the file at
+// the given path.
+type JSONFile string
+
+// Peers reads the file and returns its peers.
+func (path JSONFile) Peers() (PeerList, error) {
+	data, err := os.ReadFile(string(path))
+	if err != nil {
+		return nil, err
+	}
+	var peers PeerList
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
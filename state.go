@@ -0,0 +1,138 @@
+package wgconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// AppliedState records the set of peers that were last applied to a device
+// by this package, similar to the last-applied configuration tracked by
+// kubectl. Devices do not record which peers were added by whom, so the
+// applied state is what allows peers added by other tools or by hand to be
+// told apart from peers that were removed from the inventory.
+type AppliedState struct {
+	Device  string    `json:"device"`
+	Applied time.Time `json:"applied"`
+	Peers   PeerList  `json:"peers"`
+}
+
+// LoadAppliedState reads the applied state from the file at path. If the
+// file does not exist an empty state is returned.
+func LoadAppliedState(path string) (AppliedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return AppliedState{}, nil
+	} else if err != nil {
+		return AppliedState{}, err
+	}
+	var state AppliedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return AppliedState{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save atomically writes the applied state to the file at path.
+func (state AppliedState) Save(path string) error {
+	data, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = WriteFile(path, data, WriteOptions{Mode: 0600})
+	return err
+}
+
+// OwnedResult describes the outcome of ReconcileOwned.
+type OwnedResult struct {
+	// Added, Updated and Removed are the peers that were changed.
+	Added, Updated, Removed PeerList
+
+	// Foreign holds peers present on the device that are neither desired
+	// nor previously applied. They are left in place.
+	Foreign PeerList
+}
+
+// ReconcileOwned updates the peers of a device to match the desired peers,
+// but only removes peers that are present in lastApplied. Peers that were
+// added to the device by someone else are reported as foreign and are not
+// modified unless they are also desired. Desired peers that do not match the
+// Enabled filter are treated as absent.
+func ReconcileOwned(client Client, device string, lastApplied, desired PeerList) (OwnedResult, error) {
+	return ReconcileOwnedContext(context.Background(), client, device, lastApplied, desired)
+}
+
+// ReconcileOwnedContext updates the peers of a device in the same way as
+// ReconcileOwned. It returns early if ctx is cancelled or its deadline is
+// exceeded.
+func ReconcileOwnedContext(ctx context.Context, client Client, device string, lastApplied, desired PeerList) (OwnedResult, error) {
+	inventory := append(append(PeerList(nil), desired...), lastApplied...)
+	_, current, err := collectAnnotated(ctx, client, device, inventory)
+	if err != nil {
+		return OwnedResult{}, err
+	}
+
+	// Peers that we didn't apply and don't want are foreign
+	owned := make(map[Key]bool, len(lastApplied)+len(desired))
+	for _, list := range []PeerList{lastApplied, desired} {
+		for _, peer := range list {
+			owned[peer.PublicKey] = true
+		}
+	}
+	foreign := current.Match(func(p Peer) bool {
+		return !owned[p.PublicKey]
+	})
+	current = current.Exclude(foreign)
+
+	result, err := ReconcileContext(ctx, client, device, current, desired, ReconcileOptions{})
+	if err != nil {
+		return OwnedResult{Foreign: foreign}, err
+	}
+	return OwnedResult{
+		Added:   result.Added,
+		Updated: result.Updated,
+		Removed: result.Removed,
+		Foreign: foreign,
+	}, nil
+}
+
+// ReconcileWithState reconciles a device with the desired peers using the
+// applied state stored at path, as described by ReconcileOwned. The desired
+// peers that match the Enabled filter are recorded in the state file when
+// reconciliation succeeds. Disabled and incomplete peers are never
+// configured, so they are not recorded as applied.
+func ReconcileWithState(client Client, device, path string, desired PeerList) (OwnedResult, error) {
+	return ReconcileWithStateContext(context.Background(), client, device, path, desired)
+}
+
+// ReconcileWithStateContext reconciles a device with the desired peers in the
+// same way as ReconcileWithState. It returns early if ctx is cancelled or its
+// deadline is exceeded, in which case the state file is not updated.
+func ReconcileWithStateContext(ctx context.Context, client Client, device, path string, desired PeerList) (OwnedResult, error) {
+	state, err := LoadAppliedState(path)
+	if err != nil {
+		return OwnedResult{}, err
+	}
+	if state.Device != "" && state.Device != device {
+		return OwnedResult{}, fmt.Errorf("wgconf: applied state in %s belongs to %s, not %s", path, state.Device, device)
+	}
+
+	result, err := ReconcileOwnedContext(ctx, client, device, state.Peers, desired)
+	if err != nil {
+		return result, err
+	}
+
+	state = AppliedState{
+		Device:  device,
+		Applied: time.Now(),
+		Peers:   desired.Match(Enabled),
+	}
+	if err := state.Save(path); err != nil {
+		return result, fmt.Errorf("failed to save applied state: %w", err)
+	}
+	return result, nil
+}
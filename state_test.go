@@ -0,0 +1,92 @@
+package wgconf_test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestReconcileWithState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg0.applied.json")
+	client := newFakeClient(wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.3/32")}}},
+	})
+
+	p1 := wgconf.Peer{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}}
+	p2 := wgconf.Peer{Name: "P2", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}}
+
+	// The pre-existing peer is foreign and must be left alone
+	result, err := wgconf.ReconcileWithState(client, "wg0", path, wgconf.PeerList{p1, p2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added) != 2 || len(result.Removed) != 0 || len(result.Foreign) != 1 {
+		t.Fatalf("unexpected first result: %+v", result)
+	}
+
+	// Dropping P2 from the inventory must remove it, because we applied it
+	result, err = wgconf.ReconcileWithState(client, "wg0", path, wgconf.PeerList{p1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(result.Removed), "P2"); diff != "" || len(result.Foreign) != 1 {
+		t.Fatalf("unexpected second result (-want +got):\n%s\n%+v", diff, result)
+	}
+
+	current, err := wgconf.CollectPeers(client, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 2 || len(current.Match(wgconf.IPNet(mustParseIPNet("10.0.0.3/32")).Contains)) != 1 {
+		t.Fatalf("unexpected device peers:\n%s", current.NetDev())
+	}
+
+	if _, err := wgconf.ReconcileWithState(client, "wg1", path, nil); err == nil {
+		t.Fatal("expected an error when using state from another device")
+	}
+}
+
+func TestReconcileWithStateDisabledPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg0.applied.json")
+	client := newFakeClient(wgtypes.Device{Name: "wg0"})
+
+	p1 := wgconf.Peer{Name: "P1", PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}}
+	p2 := wgconf.Peer{Name: "P2", PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}, Disabled: true}
+	p3 := wgconf.Peer{Name: "P3", PublicKey: mustParseKey(public3)}
+
+	result, err := wgconf.ReconcileWithState(client, "wg0", path, wgconf.PeerList{p1, p2, p3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(result.Added), "P1"); diff != "" {
+		t.Fatalf("unexpected peers added (-want +got):\n%s", diff)
+	}
+
+	state, err := wgconf.LoadAppliedState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(state.Peers), "P1"); diff != "" {
+		t.Fatalf("unexpected peers recorded as applied (-want +got):\n%s", diff)
+	}
+
+	// Disabling an applied peer removes it from the device and the state
+	p1.Disabled = true
+	result, err = wgconf.ReconcileWithState(client, "wg0", path, wgconf.PeerList{p1, p2, p3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := multilineDiff(testNames(result.Removed), "P1"); diff != "" {
+		t.Fatalf("unexpected peers removed (-want +got):\n%s", diff)
+	}
+	if state, err = wgconf.LoadAppliedState(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Peers) != 0 {
+		t.Fatalf("disabled peers were recorded as applied: %v", state.Peers)
+	}
+}
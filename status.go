@@ -0,0 +1,67 @@
+package wgconf
+
+import (
+	"net"
+	"time"
+)
+
+// PeerStatus holds the runtime state of a WireGuard peer as reported by a
+// device, alongside its configuration.
+type PeerStatus struct {
+	Peer
+	Endpoint                    *net.UDPAddr
+	LastHandshake               time.Time
+	ReceiveBytes                int64
+	TransmitBytes               int64
+	PersistentKeepaliveInterval time.Duration
+	ProtocolVersion             int
+}
+
+// HasHandshake returns true if the peer has completed a handshake with the
+// device at least once.
+func (s PeerStatus) HasHandshake() bool {
+	return !s.LastHandshake.IsZero()
+}
+
+// PeerStatusList is a list of WireGuard peer states.
+type PeerStatusList []PeerStatus
+
+// Peers returns the configuration of each peer in the list.
+func (list PeerStatusList) Peers() PeerList {
+	peers := make(PeerList, 0, len(list))
+	for _, status := range list {
+		peers = append(peers, status.Peer)
+	}
+	return peers
+}
+
+// Lookup returns the state of the peer with the given public key.
+func (list PeerStatusList) Lookup(key Key) (status PeerStatus, ok bool) {
+	for _, status := range list {
+		if status.PublicKey == key {
+			return status, true
+		}
+	}
+	return PeerStatus{}, false
+}
+
+// index returns a map of the statuses in the list keyed by public key.
+func (list PeerStatusList) index() map[Key]PeerStatus {
+	index := make(map[Key]PeerStatus, len(list))
+	for _, status := range list {
+		index[status.PublicKey] = status
+	}
+	return index
+}
+
+// Annotate returns a copy of the list in which each peer has been joined
+// with its entry in inventory. See the Annotate function for details.
+func (list PeerStatusList) Annotate(inventory PeerList) PeerStatusList {
+	annotated, _ := Annotate(list.Peers(), inventory)
+	out := make(PeerStatusList, len(list))
+	for i := range list {
+		out[i] = list[i]
+		out[i].Peer = annotated[i]
+	}
+	return out
+}
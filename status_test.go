@@ -0,0 +1,62 @@
+package wgconf_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestCollectPeerStatus(t *testing.T) {
+	handshake := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	endpoint := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 51820}
+	client := newFakeClient(wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   mustParseKey(public1),
+				Endpoint:                    endpoint,
+				LastHandshakeTime:           handshake,
+				ReceiveBytes:                1024,
+				TransmitBytes:               2048,
+				PersistentKeepaliveInterval: 25 * time.Second,
+				ProtocolVersion:             1,
+				AllowedIPs:                  []net.IPNet{mustParseIPNet("10.0.0.1/32")},
+			},
+			{
+				PublicKey:  mustParseKey(public2),
+				AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")},
+			},
+		},
+	})
+
+	statuses, err := wgconf.CollectPeerStatus(client, "wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses = statuses.Annotate(wgconf.PeerList{{Name: "Laptop1", PublicKey: mustParseKey(public1)}})
+
+	status, ok := statuses.Lookup(mustParseKey(public1))
+	switch {
+	case !ok:
+		t.Fatal("collected status is missing a peer")
+	case status.Name != "Laptop1":
+		t.Errorf("unexpected name: %q", status.Name)
+	case status.Endpoint.String() != endpoint.String():
+		t.Errorf("unexpected endpoint: %s", status.Endpoint)
+	case !status.LastHandshake.Equal(handshake):
+		t.Errorf("unexpected last handshake: %s", status.LastHandshake)
+	case status.ReceiveBytes != 1024 || status.TransmitBytes != 2048:
+		t.Errorf("unexpected transfer counters: %d/%d", status.ReceiveBytes, status.TransmitBytes)
+	case status.PersistentKeepaliveInterval != 25*time.Second:
+		t.Errorf("unexpected keepalive interval: %s", status.PersistentKeepaliveInterval)
+	case status.ProtocolVersion != 1:
+		t.Errorf("unexpected protocol version: %d", status.ProtocolVersion)
+	}
+
+	if status, _ := statuses.Lookup(mustParseKey(public2)); status.HasHandshake() {
+		t.Errorf("peer without a handshake reported one")
+	}
+}
@@ -0,0 +1,88 @@
+package wgconf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DriftError is returned when a device does not match its desired peers
+// after changes have been applied to it.
+type DriftError struct {
+	Device string
+
+	// Missing holds desired peers that are not present on the device.
+	Missing PeerList
+
+	// Mismatched holds desired peers whose allowed IP addresses differ
+	// from those on the device.
+	Mismatched []Mismatch
+
+	// Lingering holds peers that should have been removed from the device
+	// but are still present.
+	Lingering PeerList
+}
+
+// Mismatch describes a peer whose allowed IP addresses on a device differ
+// from the desired addresses.
+type Mismatch struct {
+	Desired Peer
+	Actual  AllowedIPs
+}
+
+// Error returns a string representation of the error.
+func (e *DriftError) Error() string {
+	var problems []string
+	for _, peer := range e.Missing {
+		problems = append(problems, fmt.Sprintf("%s is missing", peerTitle(peer)))
+	}
+	for _, mismatch := range e.Mismatched {
+		problems = append(problems, fmt.Sprintf("%s has allowed IPs %q instead of %q", peerTitle(mismatch.Desired), mismatch.Actual, mismatch.Desired.AllowedIPs))
+	}
+	for _, peer := range e.Lingering {
+		problems = append(problems, fmt.Sprintf("%s was not removed", peerTitle(peer)))
+	}
+	return fmt.Sprintf("wgconf: WireGuard device %s does not match the desired peers: %s", e.Device, strings.Join(problems, "; "))
+}
+
+// checkDrift compares the current peers of a device with the desired peers.
+// Peers that are present in oldPeers but not in newPeers are expected to be
+// absent. Other peers on the device are ignored. It returns nil if there is
+// no drift.
+//
+// Allowed IP addresses are compared without regard to their order, because
+// devices may report them in a different order than they were configured.
+func checkDrift(device string, current, oldPeers, newPeers PeerList) *DriftError {
+	lookup := peerIndex(current)
+	desired := peerIndex(newPeers)
+
+	drift := &DriftError{Device: device}
+	for key, peer := range desired {
+		existing, found := lookup[key]
+		switch {
+		case !found:
+			drift.Missing = append(drift.Missing, *peer)
+		case !sameIPNetSet(existing.AllowedIPs, peer.AllowedIPs):
+			drift.Mismatched = append(drift.Mismatched, Mismatch{Desired: *peer, Actual: existing.AllowedIPs})
+		}
+	}
+	for _, peer := range oldPeers {
+		if _, wanted := desired[peer.PublicKey]; wanted {
+			continue
+		}
+		if _, found := lookup[peer.PublicKey]; found {
+			drift.Lingering = append(drift.Lingering, peer)
+		}
+	}
+
+	if len(drift.Missing) == 0 && len(drift.Mismatched) == 0 && len(drift.Lingering) == 0 {
+		return nil
+	}
+
+	sort.Sort(drift.Missing)
+	sort.Sort(drift.Lingering)
+	sort.Slice(drift.Mismatched, func(i, j int) bool {
+		return Compare(drift.Mismatched[i].Desired, drift.Mismatched[j].Desired) < 0
+	})
+	return drift
+}
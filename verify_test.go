@@ -0,0 +1,99 @@
+package wgconf_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// lossyClient silently drops the last peer change of its first
+// configuration call.
+type lossyClient struct {
+	*fakeClient
+	dropped bool
+}
+
+func (c *lossyClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	if !c.dropped && len(cfg.Peers) > 0 {
+		c.dropped = true
+		cfg.Peers = cfg.Peers[:len(cfg.Peers)-1]
+	}
+	return c.fakeClient.ConfigureDevice(name, cfg)
+}
+
+func TestReconcileVerify(t *testing.T) {
+	oldPeers := wgconf.PeerList{
+		{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}},
+	}
+	device := wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: mustParseKey(public1), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.1/32")}}},
+	}
+
+	t.Run("Stolen", func(t *testing.T) {
+		// Both peers claim the same address, so the first loses it
+		newPeers := wgconf.PeerList{
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32"), mustParseIPNet("10.0.9.9/32")}},
+			{PublicKey: mustParseKey(public3), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.9.9/32")}},
+		}
+		client := newFakeClient(device)
+		_, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{Verify: true, VerifyRetries: 1})
+		var drift *wgconf.DriftError
+		if !errors.As(err, &drift) {
+			t.Fatalf("expected a drift error, got %v", err)
+		}
+		if len(drift.Mismatched) != 1 || len(drift.Missing) != 0 || len(drift.Lingering) != 0 {
+			t.Fatalf("unexpected drift: %v", drift)
+		}
+	})
+
+	t.Run("HostBits", func(t *testing.T) {
+		// The device reports the masked network
+		newPeers := wgconf.PeerList{
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("192.168.1.1/30")}},
+		}
+		client := newFakeClient(device)
+		if _, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{Verify: true}); err != nil {
+			t.Fatalf("unexpected drift for an address with host bits: %v", err)
+		}
+
+		// Reconciling again has nothing to do
+		current, err := wgconf.CollectPeers(client, "wg0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := current[0].AllowedIPs.String(); got != "192.168.1.0/30" {
+			t.Fatalf("unexpected allowed IPs on device: %s", got)
+		}
+		if added, updated, removed, _ := wgconf.CompareLists(current, newPeers); len(added)+len(updated)+len(removed) != 0 {
+			t.Errorf("unexpected changes: %d added, %d updated, %d removed", len(added), len(updated), len(removed))
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		newPeers := wgconf.PeerList{
+			{PublicKey: mustParseKey(public2), AllowedIPs: []net.IPNet{mustParseIPNet("10.0.0.2/32")}},
+		}
+
+		// Without retries the dropped change is reported
+		client := &lossyClient{fakeClient: newFakeClient(device)}
+		_, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{Verify: true})
+		var drift *wgconf.DriftError
+		if !errors.As(err, &drift) || len(drift.Missing) != 1 {
+			t.Fatalf("expected a drift error for a missing peer, got %v", err)
+		}
+
+		// With a retry the dropped change is issued again
+		client = &lossyClient{fakeClient: newFakeClient(device)}
+		result, err := wgconf.Reconcile(client, "wg0", oldPeers, newPeers, wgconf.ReconcileOptions{Verify: true, VerifyRetries: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Batches) != 2 || result.Batches[1].Index != 1 {
+			t.Fatalf("unexpected batches: %+v", result.Batches)
+		}
+	})
+}
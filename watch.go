@@ -0,0 +1,253 @@
+package wgconf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Default settings for watchers.
+const (
+	DefaultWatchInterval = 10 * time.Second
+	DefaultIdleAfter     = 3 * time.Minute
+)
+
+// Observation is the state of a device's peers at a point in time.
+type Observation struct {
+	Device string
+	Time   time.Time
+	Peers  PeerStatusList
+}
+
+// Observe collects the current state of a device's peers.
+func Observe(client Client, device string) (Observation, error) {
+	return ObserveContext(context.Background(), client, device)
+}
+
+// ObserveContext collects the current state of a device's peers. It returns
+// early if ctx is cancelled or its deadline is exceeded.
+func ObserveContext(ctx context.Context, client Client, device string) (Observation, error) {
+	peers, err := CollectPeerStatusContext(ctx, client, device)
+	if err != nil {
+		return Observation{}, err
+	}
+	return Observation{
+		Device: device,
+		Time:   time.Now(),
+		Peers:  peers,
+	}, nil
+}
+
+// EventType identifies a kind of peer event.
+type EventType int
+
+// Peer event types.
+const (
+	// PeerConnected is emitted when a peer completes a handshake after
+	// having never completed one, or after having been idle.
+	PeerConnected EventType = iota
+
+	// PeerRoamed is emitted when the endpoint of an active peer changes.
+	PeerRoamed
+
+	// PeerIdle is emitted when an active peer has not completed a handshake
+	// within the idle timeout.
+	PeerIdle
+
+	// PeerAdded is emitted when a peer is added to the device.
+	PeerAdded
+
+	// PeerRemoved is emitted when a peer is removed from the device.
+	PeerRemoved
+)
+
+// String returns a string representation of the event type.
+func (t EventType) String() string {
+	switch t {
+	case PeerConnected:
+		return "connected"
+	case PeerRoamed:
+		return "roamed"
+	case PeerIdle:
+		return "idle"
+	case PeerAdded:
+		return "added"
+	case PeerRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change in the state of a peer.
+type Event struct {
+	Type   EventType
+	Device string
+	Time   time.Time
+
+	// Peer is the state of the peer when the event was detected. For
+	// removals it is the last known state of the peer.
+	Peer PeerStatus
+
+	// PreviousEndpoint is the endpoint of the peer before it roamed. It is
+	// only set for PeerRoamed events.
+	PreviousEndpoint *net.UDPAddr
+}
+
+// String returns a description of the event.
+func (e Event) String() string {
+	peer := e.Peer.Name
+	if peer == "" {
+		peer = sanitizeKey(e.Peer.PublicKey)
+	}
+	switch e.Type {
+	case PeerConnected:
+		if e.Peer.Endpoint != nil {
+			return fmt.Sprintf("%s: peer %s connected from %s", e.Device, peer, e.Peer.Endpoint.IP)
+		}
+	case PeerRoamed:
+		if e.PreviousEndpoint != nil && e.Peer.Endpoint != nil {
+			return fmt.Sprintf("%s: peer %s roamed from %s to %s", e.Device, peer, e.PreviousEndpoint.IP, e.Peer.Endpoint.IP)
+		}
+	case PeerIdle:
+		return fmt.Sprintf("%s: peer %s went idle", e.Device, peer)
+	}
+	return fmt.Sprintf("%s: peer %s %s", e.Device, peer, e.Type)
+}
+
+// DetectEvents returns the events that occurred between two observations of
+// the same device. A peer is considered active when its last handshake
+// occurred within idleAfter of the observation time.
+func DetectEvents(previous, current Observation, idleAfter time.Duration) []Event {
+	active := func(status PeerStatus, now time.Time) bool {
+		return status.HasHandshake() && now.Sub(status.LastHandshake) <= idleAfter
+	}
+
+	var events []Event
+	emit := func(t EventType, status PeerStatus, endpoint *net.UDPAddr) {
+		events = append(events, Event{
+			Type:             t,
+			Device:           current.Device,
+			Time:             current.Time,
+			Peer:             status,
+			PreviousEndpoint: endpoint,
+		})
+	}
+
+	// Index both observations so that large devices can be compared in
+	// linear time
+	previousPeers, currentPeers := previous.Peers.index(), current.Peers.index()
+
+	for _, status := range current.Peers {
+		prev, existed := previousPeers[status.PublicKey]
+		if !existed {
+			emit(PeerAdded, status, nil)
+		}
+
+		wasActive := existed && active(prev, previous.Time)
+		isActive := active(status, current.Time)
+		switch {
+		case !wasActive && isActive:
+			emit(PeerConnected, status, nil)
+		case wasActive && !isActive:
+			emit(PeerIdle, status, nil)
+		case wasActive && isActive && endpointChanged(prev.Endpoint, status.Endpoint):
+			emit(PeerRoamed, status, prev.Endpoint)
+		}
+	}
+
+	for _, prev := range previous.Peers {
+		if _, exists := currentPeers[prev.PublicKey]; !exists {
+			emit(PeerRemoved, prev, nil)
+		}
+	}
+
+	return events
+}
+
+func endpointChanged(a, b *net.UDPAddr) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.String() != b.String()
+}
+
+// Watcher periodically observes a device and emits events when the state of
+// its peers changes.
+type Watcher struct {
+	// Client is used to collect device state.
+	Client Client
+
+	// Device is the name of the WireGuard device to watch.
+	Device string
+
+	// Interval is the amount of time between observations. If zero,
+	// DefaultWatchInterval is used.
+	Interval time.Duration
+
+	// IdleAfter is the amount of time since the last handshake after which
+	// a peer is considered idle. If zero, DefaultIdleAfter is used.
+	IdleAfter time.Duration
+
+	// Inventory, if provided, supplies the names, descriptions and labels
+	// of peers included in events.
+	Inventory PeerList
+}
+
+// Run observes the device until ctx is cancelled or an observation fails,
+// sending events to the given channel as they are detected. The first
+// observation establishes a baseline and does not produce events.
+//
+// Run always returns a non-nil error. When ctx is cancelled it returns
+// ctx.Err().
+func (w Watcher) Run(ctx context.Context, events chan<- Event) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	idleAfter := w.IdleAfter
+	if idleAfter <= 0 {
+		idleAfter = DefaultIdleAfter
+	}
+
+	previous, err := w.observe(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := w.observe(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range DetectEvents(previous, current, idleAfter) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case events <- event:
+			}
+		}
+
+		previous = current
+	}
+}
+
+func (w Watcher) observe(ctx context.Context) (Observation, error) {
+	obs, err := ObserveContext(ctx, w.Client, w.Device)
+	if err != nil {
+		return Observation{}, fmt.Errorf("failed to observe WireGuard device %s: %w", w.Device, err)
+	}
+	obs.Peers = obs.Peers.Annotate(w.Inventory)
+	return obs, nil
+}
@@ -0,0 +1,111 @@
+package wgconf_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/wgconf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDetectEvents(t *testing.T) {
+	t0 := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(10 * time.Minute)
+	home := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 51820}
+	away := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 9), Port: 51820}
+
+	peer := func(name, key string) wgconf.Peer {
+		return wgconf.Peer{Name: name, PublicKey: mustParseKey(key)}
+	}
+
+	previous := wgconf.Observation{
+		Device: "wg0",
+		Time:   t0,
+		Peers: wgconf.PeerStatusList{
+			{Peer: peer("First", public1)},
+			{Peer: peer("Roamer", public2), Endpoint: home, LastHandshake: t0.Add(-time.Minute)},
+			{Peer: peer("Sleeper", public3), Endpoint: home, LastHandshake: t0.Add(-time.Minute)},
+			{Peer: peer("Leaver", public4)},
+		},
+	}
+	current := wgconf.Observation{
+		Device: "wg0",
+		Time:   t1,
+		Peers: wgconf.PeerStatusList{
+			{Peer: peer("First", public1), Endpoint: home, LastHandshake: t1.Add(-time.Second)},
+			{Peer: peer("Roamer", public2), Endpoint: away, LastHandshake: t1.Add(-time.Minute)},
+			{Peer: peer("Sleeper", public3), Endpoint: home, LastHandshake: t0.Add(-time.Minute)},
+			{Peer: peer("Joiner", public5)},
+		},
+	}
+
+	var got []string
+	for _, event := range wgconf.DetectEvents(previous, current, 3*time.Minute) {
+		got = append(got, event.String())
+	}
+	want := strings.Join([]string{
+		"wg0: peer First connected from 203.0.113.7",
+		"wg0: peer Roamer roamed from 203.0.113.7 to 198.51.100.9",
+		"wg0: peer Sleeper went idle",
+		"wg0: peer Joiner added",
+		"wg0: peer Leaver removed",
+	}, "\n")
+	if diff := multilineDiff(strings.Join(got, "\n"), want); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+// observedClient signals when the first device observation has been made.
+type observedClient struct {
+	*fakeClient
+	observed chan struct{}
+}
+
+func (c observedClient) Device(name string) (*wgtypes.Device, error) {
+	dev, err := c.fakeClient.Device(name)
+	select {
+	case c.observed <- struct{}{}:
+	default:
+	}
+	return dev, err
+}
+
+func TestWatcherRun(t *testing.T) {
+	fake := newFakeClient(wgtypes.Device{Name: "wg0"})
+	client := observedClient{fakeClient: fake, observed: make(chan struct{}, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan wgconf.Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- wgconf.Watcher{Client: client, Device: "wg0", Interval: 5 * time.Millisecond}.Run(ctx, events)
+	}()
+
+	// Wait for the baseline before changing the device
+	<-client.observed
+	fake.setPeer("wg0", wgtypes.Peer{PublicKey: mustParseKey(public1), LastHandshakeTime: time.Now()})
+
+	var types []string
+	for len(types) < 2 {
+		select {
+		case event := <-events:
+			types = append(types, event.Type.String())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events; received %v", types)
+		}
+	}
+	if diff := multilineDiff(strings.Join(types, ","), "added,connected"); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error from cancelled watcher: %v", err)
+	}
+}
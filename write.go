@@ -0,0 +1,164 @@
+package wgconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteOptions control the behavior of WriteFile.
+type WriteOptions struct {
+	// Backups is the number of numbered backups of the previous file
+	// contents to keep, named path.1 through path.N with path.1 being the
+	// most recent. If zero, no backups are kept.
+	Backups int
+
+	// Mode is the file mode used when the file does not already exist. If
+	// zero, 0640 is used. Existing files retain their mode.
+	Mode fs.FileMode
+}
+
+// WriteFile atomically replaces the file at path with data. It reports
+// whether the file was changed.
+//
+// The data is written to a temporary file in the same directory, which is
+// synchronized to disk and then renamed over the target. If the target
+// already exists its mode and ownership are preserved. If the target
+// already holds the same data, WriteFile returns false without writing anything.
+//
+// If path is a symbolic link, the file it refers to is replaced and the
+// link is left in place. Backups are kept alongside the link's target.
+//
+// This makes it suitable for writing systemd netdev files, which should
+// only be reloaded when their contents have actually changed.
+func WriteFile(path string, data []byte, opts WriteOptions) (changed bool, err error) {
+	// Replace the target of a symbolic link rather than the link itself
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return false, fmt.Errorf("wgconf: failed to resolve symbolic link %s: %w", path, err)
+		}
+		path = target
+	}
+
+	// Compare the new data with the existing file
+	mode := opts.Mode
+	if mode == 0 {
+		mode = 0640
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		existing, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(existing, data) {
+			return false, nil
+		}
+		mode = info.Mode().Perm()
+	case errors.Is(err, fs.ErrNotExist):
+		info = nil
+	default:
+		return false, err
+	}
+
+	// Write the data to a temporary file
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeTemp(tmp, data, mode, info); err != nil {
+		return false, err
+	}
+
+	// Rotate backups of the existing file
+	if info != nil && opts.Backups > 0 {
+		if err := rotateBackups(path, opts.Backups); err != nil {
+			return false, fmt.Errorf("failed to rotate backups: %w", err)
+		}
+	}
+
+	// Move the temporary file into place
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	syncDir(dir)
+
+	return true, nil
+}
+
+// writeTemp writes data to tmp, applies the given mode and the ownership
+// of the original file, if any, and closes it.
+func writeTemp(tmp *os.File, data []byte, mode fs.FileMode, original fs.FileInfo) error {
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if original != nil {
+		if err := chownLike(tmp, original); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	return tmp.Close()
+}
+
+// rotateBackups shifts path.1 through path.(n-1) up by one and copies the
+// current file to path.1, discarding path.n.
+func rotateBackups(path string, n int) error {
+	for i := n - 1; i >= 1; i-- {
+		err := os.Rename(backupName(path, i), backupName(path, i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	// Hard link the current file so that it remains in place until the
+	// rename, falling back to a copy where links aren't supported
+	first := backupName(path, 1)
+	os.Remove(first)
+	if err := os.Link(path, first); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(first, data, info.Mode().Perm())
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// syncDir makes a best-effort attempt to synchronize a directory to disk so
+// that a rename within it is durable.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
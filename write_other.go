@@ -0,0 +1,13 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package wgconf
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chownLike does nothing on platforms without unix file ownership.
+func chownLike(f *os.File, original fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package wgconf_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gentlemanautomaton/wgconf"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg0.netdev")
+	opts := wgconf.WriteOptions{Backups: 2}
+
+	write := func(content string, wantChanged bool) {
+		t.Helper()
+		changed, err := wgconf.WriteFile(path, []byte(content), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != wantChanged {
+			t.Fatalf("unexpected change status when writing %q: want %t, got %t", content, wantChanged, changed)
+		}
+	}
+
+	expect := func(name, want string) {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != want {
+			t.Fatalf("unexpected contents of %s: want %q, got %q", filepath.Base(name), want, got)
+		}
+	}
+
+	write("one", true)
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	write("one", false)
+	write("two", true)
+	write("three", true)
+	write("four", true)
+
+	expect(path, "four")
+	expect(path+".1", "three")
+	expect(path+".2", "two")
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected third backup: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("file mode was not preserved: %v", mode)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("unexpected files left behind: %d entries", len(entries))
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.netdev")
+	link := filepath.Join(dir, "wg0.netdev")
+	if err := os.WriteFile(target, []byte("one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+
+	if _, err := wgconf.WriteFile(link, []byte("two"), wgconf.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symbolic link was replaced with a regular file")
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "two" {
+		t.Errorf("unexpected contents of link target: %q", data)
+	}
+}